@@ -2,7 +2,11 @@ package AST
 
 import (
 	"fmt"
+	"gledger/decimal"
+	"sort"
+	"strings"
 	"time"
+	"unicode"
 )
 
 /**
@@ -12,15 +16,23 @@ import (
 type TokenType int
 
 const (
-	TOKEN_EOF     TokenType = iota // End of File
-	TOKEN_DATE                     // YYYY-MM-DD
-	TOKEN_STRING                   // Human readable name
-	TOKEN_ACCOUNT                  // expenses:food
-	TOKEN_AMOUNT                   // 100.00 USD
-	TOKEN_NEWLINE                  // \n
-	TOKEN_INDENT                   // Indentation (for nested transactions)
-	TOKEN_ERROR                    // Error token
-	TOKEN_COMMENT                  // Comment (ignored by the parser)
+	TOKEN_EOF       TokenType = iota // End of File
+	TOKEN_DATE                       // YYYY-MM-DD
+	TOKEN_STRING                     // Human readable name
+	TOKEN_ACCOUNT                    // expenses:food
+	TOKEN_AMOUNT                     // 100.00 USD
+	TOKEN_NEWLINE                    // \n
+	TOKEN_INDENT                     // Indentation (for nested transactions)
+	TOKEN_ERROR                      // Error token
+	TOKEN_COMMENT                    // ; Comment
+	TOKEN_DIRECTIVE                  // include, account, ... at the start of a line
+	TOKEN_STATUS                     // * cleared, ! pending
+	TOKEN_EQUALS                     // = before a balance assertion
+	TOKEN_AT                         // @ unit cost or @@ total cost
+	TOKEN_LOT_COST                   // {$220.00} cost basis of a lot
+	TOKEN_LOT_DATE                   // [2024-03-01] acquisition date of a lot
+	TOKEN_TILDE                      // ~ at the start of a periodic transaction
+	TOKEN_AUTOMATED                  // = at the start of an automated transaction
 )
 
 /**
@@ -32,48 +44,737 @@ type Token struct {
 	Value  string    // The actual text of the token
 	Line   int       // Line number in the source code
 	Column int       // Column number in the source code
+	Offset int       // Byte offset of the token in the source code
 }
 
 /**
  * Some generic types later on use by the parser and the interpreter
  */
 
+/**
+ * Reconciliation status, written as * (cleared) or ! (pending) after the
+ * date of a transaction or in front of the account of a posting.
+ */
+type Status int
+
+const (
+	STATUS_UNCLEARED Status = iota
+	STATUS_PENDING
+	STATUS_CLEARED
+)
+
+// The marker as it is written in the journal
+func (status Status) Marker() string {
+	switch status {
+	case STATUS_CLEARED:
+		return "*"
+	case STATUS_PENDING:
+		return "!"
+	}
+	return ""
+}
+
+func (status Status) String() string {
+	switch status {
+	case STATUS_CLEARED:
+		return "cleared"
+	case STATUS_PENDING:
+		return "pending"
+	}
+	return "uncleared"
+}
+
+func ParseStatus(marker string) (Status, error) {
+	switch marker {
+	case "*", "cleared":
+		return STATUS_CLEARED, nil
+	case "!", "pending":
+		return STATUS_PENDING, nil
+	case "", "uncleared":
+		return STATUS_UNCLEARED, nil
+	}
+	return STATUS_UNCLEARED, fmt.Errorf("unknown status %q", marker)
+}
+
+// Where something was written, for error messages and to save new entries in the right file
+type Position struct {
+	File   string
+	Line   int
+	Column int // of the account for postings, counted from 0 like the tokens
+}
+
+func (position Position) String() string {
+	if position.File == "" {
+		return fmt.Sprintf("line %d", position.Line)
+	}
+	return fmt.Sprintf("%s:%d", position.File, position.Line)
+}
+
 type Posting struct {
-	Account string
-	Amount  Amount
+	Position Position
+	Status   Status // uncleared postings inherit the status of their transaction
+	Kind     PostingKind
+	Account  string
+	Amount   Amount
+	Elided   bool              // the amount was left out in the journal and inferred so the transaction balances
+	Comments []string          // trailing comment and the indented comment lines below the posting
+	Tags     map[string]string // :tag: and key: value metadata found in the comments
+
+	// The balance of the account in this commodity right after this posting: = $1,204.18
+	Assertion *Amount
+	Assigned  bool // no amount, only the balance it should reach: = $200
+
+	// What the amount cost: @ $1.09 per unit, or @@ $109 in total
+	Price      *Amount
+	TotalPrice bool
+
+	// The lot bought or sold: 10 VTI {$220.00} [2024-03-01]
+	Lot *Lot
+
+	// Added by an automated transaction, it is not part of the journal text
+	Generated bool
+
+	// When this posting cleared, from a date: tag, zero when not written
+	Date time.Time
+}
+
+// The account as written in the journal, virtual accounts in their brackets
+func (posting *Posting) WrittenAccount() string {
+	switch posting.Kind {
+	case POSTING_VIRTUAL:
+		return "(" + posting.Account + ")"
+	case POSTING_BALANCED_VIRTUAL:
+		return "[" + posting.Account + "]"
+	}
+	return posting.Account
+}
+
+type PostingKind int
+
+const (
+	POSTING_REAL             PostingKind = iota
+	POSTING_VIRTUAL                      // (account), left out when balancing the transaction
+	POSTING_BALANCED_VIRTUAL             // [account], has to balance with the other [account] postings
+)
+
+// Real postings balance among themselves, and so do balanced virtual ones
+var balancedKinds = []PostingKind{POSTING_REAL, POSTING_BALANCED_VIRTUAL}
+
+/**
+ * Lot is the cost basis of an investment, per unit, and when it was
+ * acquired. The date is zero when it was not written, the transaction
+ * date is used then.
+ */
+type Lot struct {
+	Cost Amount
+	Date time.Time
+}
+
+/**
+ * The amount the posting weighs in when balancing the transaction: its
+ * cost in the price commodity when there is one, then its lot cost,
+ * otherwise the amount.
+ */
+func (posting *Posting) BalancingAmount() Amount {
+	if posting.Price == nil {
+		if posting.Lot != nil {
+			cost := posting.Lot.Cost
+			cost.Value = posting.Amount.Value.Mul(cost.Value)
+			return cost
+		}
+		return posting.Amount
+	}
+
+	cost := *posting.Price
+	if posting.TotalPrice {
+		if posting.Amount.Value.IsNegative() {
+			cost.Value = cost.Value.Neg()
+		}
+		return cost
+	}
+
+	cost.Value = posting.Amount.Value.Mul(posting.Price.Value)
+	return cost
 }
 
 type Amount struct {
-	Value    float64
-	Currency string
+	Value     decimal.Decimal
+	Commodity string
+	Style     AmountStyle
+}
+
+/**
+ * How the commodity was written next to the number, so we can print it back
+ * the same way: $45.32, 100.00 EUR, -5.5 "VANGUARD 500"
+ */
+type AmountStyle struct {
+	Symbol  string // $, €, ... when the commodity was written as a symbol
+	Prefix  bool   // commodity goes before the number
+	Spaced  bool   // space between the commodity and the number
+	Grouped bool   // thousands separators: $1,204.18
 }
 
-// Too lazy to do it right now, we will do it later
 func (amount *Amount) String() string {
-	if amount.Value < 0 {
-		return fmt.Sprintf("-$%.2f", -amount.Value)
+	number := amount.Value.Abs().String()
+	if amount.Style.Grouped {
+		number = amount.Value.Abs().StringGrouped()
+	}
+	sign := ""
+	if amount.Value.IsNegative() {
+		sign = "-"
+	}
+
+	commodity := amount.Style.Symbol
+	if commodity == "" {
+		commodity = QuoteCommodity(amount.Commodity)
+	}
+
+	if commodity == "" {
+		return sign + number
+	}
+
+	separator := ""
+	if amount.Style.Spaced {
+		separator = " "
+	}
+
+	if amount.Style.Prefix {
+		return sign + commodity + separator + number
+	}
+	return sign + number + separator + commodity
+}
+
+// Commodities with anything else than letters have to be quoted: "VANGUARD 500"
+func QuoteCommodity(commodity string) string {
+	for _, character := range commodity {
+		if !unicode.IsLetter(character) && !unicode.IsSymbol(character) {
+			return `"` + commodity + `"`
+		}
+	}
+	return commodity
+}
+
+/**
+ * Balance holds one running total per commodity, we never add up
+ * dollars and euros into the same number.
+ */
+type Balance map[string]Amount
+
+func (balance Balance) Add(amount Amount) {
+	current, exists := balance[amount.Commodity]
+	if !exists {
+		balance[amount.Commodity] = amount
+		return
+	}
+	current.Value = current.Value.Add(amount.Value)
+	balance[amount.Commodity] = current
+}
+
+func (balance Balance) AddBalance(other Balance) {
+	for _, amount := range other {
+		balance.Add(amount)
+	}
+}
+
+func (balance Balance) IsZero() bool {
+	for _, amount := range balance {
+		if !amount.Value.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// Sorted commodities so reports are stable
+func (balance Balance) Commodities() []string {
+	commodities := make([]string, 0, len(balance))
+	for commodity := range balance {
+		commodities = append(commodities, commodity)
+	}
+	sort.Strings(commodities)
+	return commodities
+}
+
+// Amounts sorted by commodity, zero amounts are skipped unless everything is zero
+func (balance Balance) Amounts() []Amount {
+	var amounts []Amount
+	for _, commodity := range balance.Commodities() {
+		if amount := balance[commodity]; !amount.Value.IsZero() {
+			amounts = append(amounts, amount)
+		}
+	}
+	if len(amounts) == 0 {
+		amounts = append(amounts, Amount{Value: decimal.Zero})
 	}
-	return fmt.Sprintf("$%.2f", amount.Value)
+	return amounts
+}
+
+func (balance Balance) String() string {
+	var parts []string
+	for _, amount := range balance.Amounts() {
+		parts = append(parts, amount.String())
+	}
+	return strings.Join(parts, ", ")
 }
 
 type Transaction struct {
-	Date        time.Time
-	Description string
-	Postings    []Posting
+	Position      Position
+	Date          time.Time
+	EffectiveDate time.Time // when it cleared: 2025-01-30=2025-02-02, zero when not written
+	Status        Status
+	Description   string
+	Postings      []Posting
+	Comments      []string          // trailing comment and the indented comment lines before the first posting
+	Tags          map[string]string // :tag: and key: value metadata found in the comments
 }
 
-// Calculate the balance of a transaction by summing up the amounts of its postings
-func (transaction *Transaction) Balance() float64 {
-	balance := 0.0
-	for _, posting := range transaction.Postings {
-		balance += posting.Amount.Value
+/**
+ * Journal is the concrete syntax of a file. Every byte of the source belongs
+ * to exactly one item, so writing the items back gives the same file.
+ */
+type Journal struct {
+	File     string // absolute path, empty for a journal that was never loaded
+	Items    []*Item
+	Modified bool // something was added since it was loaded
+}
+
+type ItemKind int
+
+const (
+	ITEM_TRANSACTION ItemKind = iota
+	ITEM_COMMENT              // ; comment lines
+	ITEM_BLANK                // empty lines
+	ITEM_DIRECTIVE            // include, account, ...
+	ITEM_PERIODIC             // ~ monthly periodic transactions
+	ITEM_AUTOMATED            // = expenses:dining automated transactions
+)
+
+type Item struct {
+	Kind        ItemKind
+	Text        string // original text including the trailing newline, empty for items created in memory
+	Line        int
+	Transaction *Transaction
+	Directive   *Directive
+	Periodic    *PeriodicTransaction
+	Automated   *AutomatedTransaction
+}
+
+type Directive struct {
+	Name     string
+	Argument string
+	Price    *MarketPrice // P directives
+}
+
+// The price of one unit of a commodity on a date: P 2025-01-15 AAPL $185.20
+type MarketPrice struct {
+	Date      time.Time
+	Commodity string
+	Price     Amount
+}
+
+/**
+ * The five kinds of accounts of double-entry bookkeeping, declared with
+ * the account directive: account assets:checking asset
+ */
+type AccountType int
+
+const (
+	ACCOUNT_UNKNOWN AccountType = iota
+	ACCOUNT_ASSET
+	ACCOUNT_LIABILITY
+	ACCOUNT_EQUITY
+	ACCOUNT_INCOME
+	ACCOUNT_EXPENSE
+)
+
+func (accountType AccountType) String() string {
+	switch accountType {
+	case ACCOUNT_ASSET:
+		return "asset"
+	case ACCOUNT_LIABILITY:
+		return "liability"
+	case ACCOUNT_EQUITY:
+		return "equity"
+	case ACCOUNT_INCOME:
+		return "income"
+	case ACCOUNT_EXPENSE:
+		return "expense"
 	}
+	return "unknown"
+}
+
+func ParseAccountType(name string) (AccountType, error) {
+	switch strings.ToLower(name) {
+	case "asset", "assets", "a":
+		return ACCOUNT_ASSET, nil
+	case "liability", "liabilities", "l":
+		return ACCOUNT_LIABILITY, nil
+	case "equity", "e":
+		return ACCOUNT_EQUITY, nil
+	case "income", "revenue", "revenues", "r":
+		return ACCOUNT_INCOME, nil
+	case "expense", "expenses", "x":
+		return ACCOUNT_EXPENSE, nil
+	}
+	return ACCOUNT_UNKNOWN, fmt.Errorf("unknown account type %q", name)
+}
+
+func (journal *Journal) Transactions() []*Transaction {
+	var transactions []*Transaction
+	for _, item := range journal.Items {
+		if item.Kind == ITEM_TRANSACTION {
+			transactions = append(transactions, item.Transaction)
+		}
+	}
+	return transactions
+}
+
+/**
+ * Insert a new transaction after the last one with the same or an earlier
+ * date, so the file stays in date order. Only the transaction and a blank
+ * line to separate it are added, everything else is left untouched.
+ */
+func (journal *Journal) InsertTransaction(transaction *Transaction) {
+	item := &Item{Kind: ITEM_TRANSACTION, Transaction: transaction}
+	transaction.Position.File = journal.File
+	journal.Modified = true
+
+	after, first := -1, -1
+	for i, existing := range journal.Items {
+		if existing.Kind != ITEM_TRANSACTION {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		if !existing.Transaction.Date.After(transaction.Date) {
+			after = i
+		}
+	}
+
+	switch {
+	case after >= 0:
+		separator := "\n"
+		if !strings.HasSuffix(journal.Items[after].Text, "\n") && journal.Items[after].Text != "" {
+			separator = "\n\n"
+		}
+		journal.insertItems(after+1, &Item{Kind: ITEM_BLANK, Text: separator}, item)
+	case first >= 0:
+		journal.insertItems(first, item, &Item{Kind: ITEM_BLANK, Text: "\n"})
+	case len(journal.Items) > 0:
+		separator := "\n"
+		if last := journal.Items[len(journal.Items)-1].Text; last != "" && !strings.HasSuffix(last, "\n") {
+			separator = "\n\n"
+		}
+		journal.insertItems(len(journal.Items), &Item{Kind: ITEM_BLANK, Text: separator}, item)
+	default:
+		journal.Items = append(journal.Items, item)
+	}
+}
+
+func (journal *Journal) insertItems(index int, items ...*Item) {
+	journal.Items = append(journal.Items[:index], append(items, journal.Items[index:]...)...)
+}
+
+/**
+ * Metadata lives in comments, ledger style:
+ *
+ *   ; :groceries:family:      tags without a value
+ *   ; receipt: 2025-0113.pdf  a tag with a value
+ *   ; date:2025-02-02         the space after the colon is optional
+ *
+ * Comments that are neither are just comments.
+ */
+func ParseTags(comment string) map[string]string {
+	return addTags(map[string]string{}, comment)
+}
+
+// The tags of comment added to tags, which is made when it is nil and there are some
+func addTags(tags map[string]string, comment string) map[string]string {
+	comment = strings.TrimSpace(comment)
+
+	if len(comment) > 1 && strings.HasPrefix(comment, ":") && strings.HasSuffix(comment, ":") && !strings.ContainsAny(comment, " \t") {
+		for _, name := range strings.Split(comment, ":") {
+			if name != "" {
+				tags = setTag(tags, name, "")
+			}
+		}
+		return tags
+	}
+
+	if separator := strings.Index(comment, ":"); separator > 0 {
+		name := comment[:separator]
+		rest := comment[separator+1:]
+		// Links like https://example.com are not tags
+		if !strings.ContainsAny(name, " \t") && !strings.HasPrefix(rest, "//") {
+			tags = setTag(tags, name, strings.TrimSpace(rest))
+		}
+	}
+
+	return tags
+}
+
+func setTag(tags map[string]string, name, value string) map[string]string {
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	tags[name] = value
+	return tags
+}
+
+func tagsFromComments(comments []string) map[string]string {
+	var tags map[string]string
+	for _, comment := range comments {
+		tags = addTags(tags, comment)
+	}
+	return tags
+}
+
+// Fill in the tags from the comments, the parser calls this once the comments are known
+func (transaction *Transaction) CollectTags() {
+	transaction.Tags = tagsFromComments(transaction.Comments)
+	for i := range transaction.Postings {
+		transaction.Postings[i].Tags = tagsFromComments(transaction.Postings[i].Comments)
+	}
+}
+
+// Add a tag through a comment so it is written back with the transaction
+func (transaction *Transaction) AddTag(name, value string) {
+	transaction.Comments = append(transaction.Comments, FormatTag(name, value))
+	if transaction.Tags == nil {
+		transaction.Tags = map[string]string{}
+	}
+	transaction.Tags[name] = value
+}
+
+func FormatTag(name, value string) string {
+	if value == "" {
+		return ":" + name + ":"
+	}
+	return name + ": " + value
+}
+
+// Postings carry the tags of their transaction, their own ones win
+func (transaction *Transaction) PostingTag(posting *Posting, name string) (string, bool) {
+	if value, exists := posting.Tags[name]; exists {
+		return value, true
+	}
+	value, exists := transaction.Tags[name]
+	return value, exists
+}
+
+// A posting without its own marker is as cleared as its transaction
+func (transaction *Transaction) PostingStatus(posting *Posting) Status {
+	if posting.Status != STATUS_UNCLEARED {
+		return posting.Status
+	}
+	return transaction.Status
+}
+
+/**
+ * The date a posting counts on. By default the transaction date, with
+ * effective the clearing date: the date: tag of the posting, then the
+ * effective date of the transaction.
+ */
+func (transaction *Transaction) PostingDate(posting *Posting, effective bool) time.Time {
+	if effective {
+		if !posting.Date.IsZero() {
+			return posting.Date
+		}
+		if !transaction.EffectiveDate.IsZero() {
+			return transaction.EffectiveDate
+		}
+	}
+	return transaction.Date
+}
+
+// Calculate the balance of a transaction by summing up the costs of its real postings, per commodity
+func (transaction *Transaction) Balance() Balance {
+	return transaction.balanceOf(POSTING_REAL)
+}
+
+// The sum of the [account] postings, zero when the transaction is balanced
+func (transaction *Transaction) VirtualBalance() Balance {
+	return transaction.balanceOf(POSTING_BALANCED_VIRTUAL)
+}
+
+// What keeps the transaction from balancing, in brackets when it is the [account] postings
+func (transaction *Transaction) Imbalance() string {
+	real := transaction.Balance()
+	for commodity, amount := range real {
+		if !amount.Value.Round(transaction.Precision(commodity)).IsZero() {
+			return real.String()
+		}
+	}
+	return "[" + transaction.VirtualBalance().String() + "]"
+}
+
+func (transaction *Transaction) balanceOf(kind PostingKind) Balance {
+	balance := Balance{}
+	transaction.addBalanceOf(kind, balance)
 	return balance
 }
 
-// Debug safety check
+func (transaction *Transaction) addBalanceOf(kind PostingKind, balance Balance) {
+	for i := range transaction.Postings {
+		if posting := &transaction.Postings[i]; posting.Kind == kind {
+			balance.Add(posting.BalancingAmount())
+		}
+	}
+}
+
+/**
+ * The precision of a commodity is the most decimal places used by any of
+ * the amounts written in it. Costs worked out from a price (3 @ $1.333)
+ * only count when the commodity is not written anywhere else.
+ */
+func (transaction *Transaction) Precision(commodity string) int32 {
+	precision, written := int32(0), false
+	for _, posting := range transaction.Postings {
+		if posting.Amount.Commodity == commodity && !posting.Elided {
+			written = true
+			if posting.Amount.Value.Scale() > precision {
+				precision = posting.Amount.Value.Scale()
+			}
+		}
+	}
+
+	if !written {
+		for _, posting := range transaction.Postings {
+			if cost := posting.BalancingAmount(); cost.Commodity == commodity && cost.Value.Scale() > precision {
+				precision = cost.Value.Scale()
+			}
+		}
+	}
+
+	return precision
+}
+
+/**
+ * A transaction is balanced only when every commodity sums to exactly zero
+ * in its precision, for the real postings and for the balanced virtual ones.
+ */
 func (transaction *Transaction) IsBalanced() bool {
-	balance := transaction.Balance()
-	// floating points are failing me sometimes
-	return balance > -0.01 && balance < 0.01
+	for _, kind := range balancedKinds {
+		// Not returned, so it stays off the heap: this runs for every transaction read
+		balance := Balance{}
+		transaction.addBalanceOf(kind, balance)
+		for commodity, amount := range balance {
+			if !amount.Value.Round(transaction.Precision(commodity)).IsZero() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Balance assignments can only be worked out with the running balances of the whole journal
+func (transaction *Transaction) HasBalanceAssignments() bool {
+	for _, posting := range transaction.Postings {
+		if posting.Assigned {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * Go back to the postings as they were written: elided postings split per
+ * commodity become one again, computed amounts are cleared and automated
+ * postings dropped, so they can be worked out again when earlier
+ * transactions change.
+ */
+func (transaction *Transaction) ResetInferredAmounts() {
+	var postings []Posting
+	elidedSeen := map[PostingKind]bool{}
+	for _, posting := range transaction.Postings {
+		if posting.Generated {
+			continue
+		}
+		if posting.Elided {
+			if elidedSeen[posting.Kind] {
+				continue
+			}
+			elidedSeen[posting.Kind] = true
+		}
+		if posting.Elided || posting.Assigned {
+			posting.Amount = Amount{}
+		}
+		postings = append(postings, posting)
+	}
+	transaction.Postings = postings
+}
+
+/**
+ * One posting per transaction may leave out its amount, it gets whatever is
+ * needed to balance the rest. When several commodities are left over the
+ * posting is split into one posting per commodity, all marked as elided.
+ * Balanced virtual postings can have their own posting without an amount.
+ */
+func (transaction *Transaction) InferElidedAmounts() error {
+	for _, posting := range transaction.Postings {
+		if posting.Kind == POSTING_VIRTUAL && posting.Elided {
+			return fmt.Errorf("virtual postings need an amount")
+		}
+	}
+
+	for _, kind := range balancedKinds {
+		if err := transaction.inferElided(kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (transaction *Transaction) inferElided(kind PostingKind) error {
+	elided := -1
+	residual := Balance{}
+
+	for i := range transaction.Postings {
+		posting := &transaction.Postings[i]
+		if posting.Kind != kind {
+			continue
+		}
+		if !posting.Elided {
+			residual.Add(posting.BalancingAmount())
+			continue
+		}
+		if elided >= 0 {
+			return fmt.Errorf("only one posting with an omitted amount is allowed per transaction")
+		}
+		elided = i
+	}
+
+	if elided < 0 {
+		return nil
+	}
+
+	original := transaction.Postings[elided]
+	var inferred []Posting
+	for _, commodity := range residual.Commodities() {
+		amount := residual[commodity]
+		if amount.Value.IsZero() {
+			continue
+		}
+		amount.Value = amount.Value.Neg()
+		posting := original
+		posting.Amount = amount
+		inferred = append(inferred, posting)
+	}
+
+	// Nothing left over, the posting stays without an amount. One commodity, the usual case, fits in its place
+	switch len(inferred) {
+	case 0:
+		return nil
+	case 1:
+		transaction.Postings[elided] = inferred[0]
+		return nil
+	}
+
+	postings := make([]Posting, 0, len(transaction.Postings)+len(inferred)-1)
+	postings = append(postings, transaction.Postings[:elided]...)
+	postings = append(postings, inferred...)
+	transaction.Postings = append(postings, transaction.Postings[elided+1:]...)
+
+	return nil
 }
@@ -0,0 +1,70 @@
+package AST
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/**
+ * AutomatedTransaction adds postings to every transaction with a posting
+ * matching its query:
+ *
+ *	= expenses:dining
+ *	    (budget:dining)        -1.0
+ *
+ * The query is an account, which also matches its sub-accounts, or a
+ * regular expression between slashes (= /dining|food/). Template amounts
+ * without a commodity multiply the matched amount, amounts with one are
+ * added as they are.
+ */
+type AutomatedTransaction struct {
+	Query       string
+	Transaction *Transaction // the template postings, its date is not used
+	pattern     *regexp.Regexp
+}
+
+func NewAutomatedTransaction(query string, transaction *Transaction) (*AutomatedTransaction, error) {
+	automated := &AutomatedTransaction{Query: query, Transaction: transaction}
+
+	if len(query) > 1 && strings.HasPrefix(query, "/") && strings.HasSuffix(query, "/") {
+		pattern, err := regexp.Compile(query[1 : len(query)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %v", query, err)
+		}
+		automated.pattern = pattern
+	}
+
+	return automated, nil
+}
+
+func (automated *AutomatedTransaction) Matches(account string) bool {
+	if automated.pattern != nil {
+		return automated.pattern.MatchString(account)
+	}
+	return account == automated.Query || strings.HasPrefix(account, automated.Query+":")
+}
+
+/**
+ * The postings the template adds for a matched posting. Multiplied amounts
+ * are exact, with at least the precision of the matched amount.
+ */
+func (automated *AutomatedTransaction) Apply(matched *Posting) []Posting {
+	var generated []Posting
+	for _, template := range automated.Transaction.Postings {
+		posting := template
+		posting.Generated = true
+
+		if template.Amount.Commodity == "" {
+			value := matched.Amount.Value.Mul(template.Amount.Value).Normalize()
+			if value.Scale() < matched.Amount.Value.Scale() {
+				value = value.Rescale(matched.Amount.Value.Scale())
+			}
+			posting.Amount = matched.Amount
+			posting.Amount.Value = value
+		}
+
+		generated = append(generated, posting)
+	}
+	return generated
+}
@@ -0,0 +1,208 @@
+package AST
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * PeriodicTransaction describes postings expected every period:
+ *
+ *	~ monthly from 2025-01  Rent
+ *	    expenses:rent          $1,500.00
+ *	    assets:checking
+ *
+ * They drive budgets and forecasts and are never turned into real
+ * transactions. The date of the transaction is not used.
+ */
+type PeriodicTransaction struct {
+	Period      Period
+	Transaction *Transaction
+}
+
+type PeriodUnit int
+
+const (
+	PERIOD_DAY PeriodUnit = iota
+	PERIOD_WEEK
+	PERIOD_MONTH
+	PERIOD_QUARTER
+	PERIOD_YEAR
+)
+
+/**
+ * Period is a repeating interval, "every 2 weeks from 2025-01-03 to 2025-07".
+ * Start and End are zero when not given, End is exclusive.
+ */
+type Period struct {
+	Expression string // as written
+	Unit       PeriodUnit
+	Count      int
+	Start      time.Time
+	End        time.Time
+}
+
+var periodWords = map[string]struct {
+	unit  PeriodUnit
+	count int
+}{
+	"daily":       {PERIOD_DAY, 1},
+	"weekly":      {PERIOD_WEEK, 1},
+	"biweekly":    {PERIOD_WEEK, 2},
+	"fortnightly": {PERIOD_WEEK, 2},
+	"monthly":     {PERIOD_MONTH, 1},
+	"bimonthly":   {PERIOD_MONTH, 2},
+	"quarterly":   {PERIOD_QUARTER, 1},
+	"yearly":      {PERIOD_YEAR, 1},
+	"annually":    {PERIOD_YEAR, 1},
+}
+
+var periodUnits = map[string]PeriodUnit{
+	"day": PERIOD_DAY, "days": PERIOD_DAY,
+	"week": PERIOD_WEEK, "weeks": PERIOD_WEEK,
+	"month": PERIOD_MONTH, "months": PERIOD_MONTH,
+	"quarter": PERIOD_QUARTER, "quarters": PERIOD_QUARTER,
+	"year": PERIOD_YEAR, "years": PERIOD_YEAR,
+}
+
+/**
+ * ParsePeriod reads "monthly", "every 2 weeks", "every month", optionally
+ * followed by "from DATE" and "to DATE" (or "until DATE"). Dates are read
+ * with parseDate, so they can be in the configured format, or be a month
+ * (2025-01, 2025/01, 01/2025) or a year (2025).
+ */
+func ParsePeriod(expression string, parseDate func(string) (time.Time, error)) (Period, error) {
+	period := Period{Expression: strings.TrimSpace(expression), Count: 1}
+	words := strings.Fields(strings.ToLower(expression))
+
+	if len(words) == 0 {
+		return period, fmt.Errorf("missing period")
+	}
+
+	if interval, found := periodWords[words[0]]; found {
+		period.Unit, period.Count = interval.unit, interval.count
+		words = words[1:]
+	} else if words[0] == "every" && len(words) > 1 {
+		words = words[1:]
+		if count, err := strconv.Atoi(words[0]); err == nil && len(words) > 1 {
+			if count < 1 {
+				return period, fmt.Errorf("invalid period %q", expression)
+			}
+			period.Count = count
+			words = words[1:]
+		}
+		unit, found := periodUnits[words[0]]
+		if !found {
+			return period, fmt.Errorf("unknown interval %q in period %q", words[0], expression)
+		}
+		period.Unit = unit
+		words = words[1:]
+	} else {
+		return period, fmt.Errorf("unknown interval %q in period %q", words[0], expression)
+	}
+
+	for len(words) > 0 {
+		if len(words) < 2 {
+			return period, fmt.Errorf("missing date after %q in period %q", words[0], expression)
+		}
+
+		date, err := parsePeriodDate(words[1], parseDate)
+		if err != nil {
+			return period, fmt.Errorf("invalid date %q in period %q", words[1], expression)
+		}
+
+		switch words[0] {
+		case "from":
+			period.Start = date
+		case "to", "until":
+			period.End = date
+		default:
+			return period, fmt.Errorf("unexpected %q in period %q", words[0], expression)
+		}
+		words = words[2:]
+	}
+
+	if !period.Start.IsZero() && !period.End.IsZero() && !period.End.After(period.Start) {
+		return period, fmt.Errorf("period %q ends before it starts", expression)
+	}
+
+	return period, nil
+}
+
+// A period can start on the first of a month or of a year, none of the date formats cover those
+var periodLayouts = []string{"2006-1", "2006/1", "2006.1", "1/2006", "1.2006", "2006"}
+
+func parsePeriodDate(value string, parseDate func(string) (time.Time, error)) (time.Time, error) {
+	if date, err := parseDate(value); err == nil {
+		return date, nil
+	}
+	for _, layout := range periodLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+// The date of the occurrence n intervals after start
+func (period Period) step(start time.Time, n int) time.Time {
+	n *= period.Count
+	switch period.Unit {
+	case PERIOD_WEEK:
+		return start.AddDate(0, 0, 7*n)
+	case PERIOD_MONTH:
+		return start.AddDate(0, n, 0)
+	case PERIOD_QUARTER:
+		return start.AddDate(0, 3*n, 0)
+	case PERIOD_YEAR:
+		return start.AddDate(n, 0, 0)
+	}
+	return start.AddDate(0, 0, n)
+}
+
+// The date one interval after date
+func (period Period) Next(date time.Time) time.Time {
+	return period.step(date, 1)
+}
+
+// Beginning of the interval containing date: Monday, the 1st of the month, of the quarter, January 1st
+func (period Period) Align(date time.Time) time.Time {
+	year, month, day := date.Date()
+	switch period.Unit {
+	case PERIOD_WEEK:
+		weekday := (int(date.Weekday()) + 6) % 7
+		return time.Date(year, month, day-weekday, 0, 0, 0, 0, date.Location())
+	case PERIOD_MONTH:
+		return time.Date(year, month, 1, 0, 0, 0, 0, date.Location())
+	case PERIOD_QUARTER:
+		return time.Date(year, month-(month-1)%3, 1, 0, 0, 0, 0, date.Location())
+	case PERIOD_YEAR:
+		return time.Date(year, time.January, 1, 0, 0, 0, 0, date.Location())
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, date.Location())
+}
+
+/**
+ * Dates the period falls on from from (inclusive) to to (exclusive). A
+ * period without a start date begins with the interval containing from.
+ */
+func (period Period) Occurrences(from, to time.Time) []time.Time {
+	start := period.Start
+	if start.IsZero() {
+		start = period.Align(from)
+	}
+
+	var dates []time.Time
+	for n := 0; ; n++ {
+		date := period.step(start, n)
+		if !date.Before(to) || (!period.End.IsZero() && !date.Before(period.End)) {
+			break
+		}
+		if !date.Before(from) {
+			dates = append(dates, date)
+		}
+	}
+	return dates
+}
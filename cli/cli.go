@@ -16,6 +16,12 @@ func Run(args []string) error {
 	switch command {
 	case "add":
 		return commands.AddCommand(commandArgs)
+	case "balance", "bal":
+		return commands.BalanceCommand(commandArgs)
+	case "budget":
+		return commands.BudgetCommand(commandArgs)
+	case "gains":
+		return commands.GainsCommand(commandArgs)
 	case "list", "ls":
 		return commands.ListCommand(commandArgs)
 	case "help", "-h", "--help":
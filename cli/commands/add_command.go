@@ -6,27 +6,28 @@ import (
 	AST "gledger/ast"
 	"gledger/config"
 	Interpreter "gledger/interpreter"
+	"gledger/utils"
 	"time"
 )
 
 func AddCommand(args []string) error {
+	config, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return err
+	}
+
 	addFlags := flag.NewFlagSet("add", flag.ExitOnError)
 
 	// Define a transaction input
-	dateFlag := addFlags.String("date", "", "Date of the transaction (YYYY-MM-DD)")
+	dateFlag := addFlags.String("date", "", "Date of the transaction ("+utils.DatePattern(config.DateFormat)+")")
 	descriptionFlag := addFlags.String("description", "", "Description of the transaction")
-	amountFlag := addFlags.Float64("amount", 0.0, "Amount of the transaction")
+	amountFlag := addFlags.String("amount", "", "Amount of the transaction")
 	fromFlag := addFlags.String("from", "", "Account for the transaction")
 	toFlag := addFlags.String("to", "", "Account for the transaction")
 
 	addFlags.Parse(args)
 
-	config, err := config.LoadConfig()
-	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
-		return err
-	}
-
 	interpreter := Interpreter.NewInterpreter(config)
 	if err := interpreter.LoadFromFile(config.DataFile); err != nil {
 		fmt.Printf("Error loading data file: %v\n", err)
@@ -36,7 +37,7 @@ func AddCommand(args []string) error {
 	var transaction *AST.Transaction
 
 	if *dateFlag != "" {
-		transaction, err = createTransaction(*dateFlag, *descriptionFlag, *amountFlag, *fromFlag, *toFlag)
+		transaction, err = createTransaction(*dateFlag, *descriptionFlag, *amountFlag, *fromFlag, *toFlag, config)
 	}
 
 	if err != nil {
@@ -55,38 +56,56 @@ func AddCommand(args []string) error {
 	}
 
 	fmt.Println("✓ Transaction added successfully!")
-	printTransaction(transaction, 0)
+	printTransaction(transaction, 0, config.DateLayout())
 
 	return nil
 }
 
-func createTransaction(date, description string, amount float64, from, to string) (*AST.Transaction, error) {
-	parseDate, err := time.Parse("2006-01-02", date)
+func createTransaction(date, description, amount, from, to string, config *config.Config) (*AST.Transaction, error) {
+	parseDate, err := utils.ParseDate(date, config.DateFormat, time.Now().Year())
 	if err != nil {
 		return nil, fmt.Errorf("invalid date format: %v", err)
 	}
 
-	if description == "" || from == "" || to == "" || amount == 0 {
+	if description == "" || from == "" || to == "" || amount == "" {
 		return nil, fmt.Errorf("description, from, to and amount are required fields")
 	}
 
+	value, err := utils.ParseAmount(amount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount: %v", err)
+	}
+
+	if value.Value.IsZero() {
+		return nil, fmt.Errorf("amount can not be zero")
+	}
+
+	value = utils.WithDefaultCommodity(value, config.Currency)
+	negated := value
+	negated.Value = value.Value.Neg()
+
 	return &AST.Transaction{
 		Date:        parseDate,
 		Description: description,
 		Postings: []AST.Posting{
-			{Account: from, Amount: AST.Amount{Value: -amount, Currency: "USD"}},
-			{Account: to, Amount: AST.Amount{Value: amount, Currency: "USD"}},
+			{Account: from, Amount: negated},
+			{Account: to, Amount: value},
 		},
 	}, nil
 }
 
-func printTransaction(transaction *AST.Transaction, index int) {
+func printTransaction(transaction *AST.Transaction, index int, dateLayout string) {
 	if index > 0 {
 		fmt.Printf("[%d] ", index)
 	}
 
-	fmt.Printf("%s  %s\n", transaction.Date.Format("2006-01-02"), transaction.Description)
+	status := ""
+	if marker := transaction.Status.Marker(); marker != "" {
+		status = marker + " "
+	}
+
+	fmt.Printf("%s  %s%s\n", transaction.Date.Format(dateLayout), status, transaction.Description)
 	for _, posting := range transaction.Postings {
-		fmt.Printf("    %-40s  %.2f\n", posting.Account, posting.Amount.Value)
+		fmt.Printf("    %-40s  %s\n", posting.WrittenAccount(), posting.Amount.String())
 	}
 }
@@ -0,0 +1,38 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"gledger/config"
+	Interpreter "gledger/interpreter"
+)
+
+func BalanceCommand(args []string) error {
+	config, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return err
+	}
+
+	balanceFlags := flag.NewFlagSet("balance", flag.ExitOnError)
+
+	report := registerReportFlags(balanceFlags, config.DateFormat)
+
+	balanceFlags.Parse(args)
+
+	options, err := report.options()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	interpreter := Interpreter.NewInterpreter(config)
+	if err := interpreter.LoadFromFile(config.DataFile); err != nil {
+		fmt.Printf("Error loading data file: %v\n", err)
+		return err
+	}
+
+	fmt.Print(interpreter.GenerateBalanceReport(options))
+
+	return nil
+}
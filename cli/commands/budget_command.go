@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	AST "gledger/ast"
+	"gledger/config"
+	Interpreter "gledger/interpreter"
+	"gledger/utils"
+	"time"
+)
+
+func BudgetCommand(args []string) error {
+	config, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return err
+	}
+
+	budgetFlags := flag.NewFlagSet("budget", flag.ExitOnError)
+
+	report := registerReportFlags(budgetFlags, config.DateFormat)
+	period := budgetFlags.String("period", "monthly", "Length of each period: weekly, monthly, quarterly, yearly, every 2 weeks, ...")
+
+	budgetFlags.Parse(args)
+
+	reportOptions, err := report.options()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	options := Interpreter.BudgetOptions{ReportOptions: reportOptions}
+
+	options.Interval, err = AST.ParsePeriod(*period, func(value string) (time.Time, error) {
+		return utils.ParseDate(value, config.DateFormat, time.Now().Year())
+	})
+	if err != nil {
+		fmt.Printf("Invalid period: %v\n", err)
+		return err
+	}
+
+	interpreter := Interpreter.NewInterpreter(config)
+	if err := interpreter.LoadFromFile(config.DataFile); err != nil {
+		fmt.Printf("Error loading data file: %v\n", err)
+		return err
+	}
+
+	fmt.Print(interpreter.GenerateBudgetReport(options))
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"gledger/config"
+	Interpreter "gledger/interpreter"
+)
+
+func GainsCommand(args []string) error {
+	config, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return err
+	}
+
+	gainsFlags := flag.NewFlagSet("gains", flag.ExitOnError)
+
+	report := registerReportFlags(gainsFlags, config.DateFormat)
+
+	gainsFlags.Parse(args)
+
+	options, err := report.options()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	interpreter := Interpreter.NewInterpreter(config)
+	if err := interpreter.LoadFromFile(config.DataFile); err != nil {
+		fmt.Printf("Error loading data file: %v\n", err)
+		return err
+	}
+
+	fmt.Print(interpreter.GenerateGainsReport(options))
+
+	return nil
+}
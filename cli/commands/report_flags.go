@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	AST "gledger/ast"
+	Interpreter "gledger/interpreter"
+	"gledger/utils"
+	"strings"
+	"time"
+)
+
+// Flags shared by every command that produces a report
+type reportFlags struct {
+	cleared   *bool
+	pending   *bool
+	uncleared *bool
+	tags      stringList
+	value     *bool
+	market    *bool
+	valueDate *string
+	forecast  *string
+	real      *bool
+	begin     *string
+	end       *string
+	effective *bool
+
+	dateFormat string // Go layout of the configured date format
+}
+
+// A flag that can be given more than once
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// Dates are shown in the help the way the config says they are written
+func registerReportFlags(flags *flag.FlagSet, dateFormat string) *reportFlags {
+	report := &reportFlags{dateFormat: dateFormat}
+	pattern := utils.DatePattern(dateFormat)
+
+	report.cleared = flags.Bool("cleared", false, "Only include cleared (*) postings")
+	report.pending = flags.Bool("pending", false, "Only include pending (!) postings")
+	report.uncleared = flags.Bool("uncleared", false, "Only include uncleared postings")
+	flags.Var(&report.tags, "tag", "Only include postings with this tag, name or name=value (repeatable)")
+	report.value = flags.Bool("value", false, "Show amounts in the configured currency at market prices")
+	report.market = flags.Bool("market", false, "Same as --value")
+	report.valueDate = flags.String("value-date", "", "Use the prices of this date ("+pattern+") instead of the day before -end, or today's")
+	report.real = flags.Bool("real", false, "Leave out virtual (account) and [account] postings")
+	report.forecast = flags.String("forecast", "", "Include periodic transactions up to this date ("+pattern+")")
+	report.begin = flags.String("begin", "", "Only include postings on or after this date ("+pattern+")")
+	report.end = flags.String("end", "", "Only include postings before this date ("+pattern+")")
+	report.effective = flags.Bool("effective", false, "Use clearing dates (2025-01-30=2025-02-02, date: tags) instead of transaction dates")
+
+	return report
+}
+
+// Dates can be written in the configured format or any format the journal accepts
+func (report *reportFlags) options() (Interpreter.ReportOptions, error) {
+	options := Interpreter.ReportOptions{}
+
+	if *report.cleared {
+		options.Statuses = append(options.Statuses, AST.STATUS_CLEARED)
+	}
+	if *report.pending {
+		options.Statuses = append(options.Statuses, AST.STATUS_PENDING)
+	}
+	if *report.uncleared {
+		options.Statuses = append(options.Statuses, AST.STATUS_UNCLEARED)
+	}
+
+	for _, tag := range report.tags {
+		options.Tags = append(options.Tags, Interpreter.ParseTagFilter(tag))
+	}
+
+	options.Real = *report.real
+	options.Effective = *report.effective
+	options.Market = *report.value || *report.market
+
+	dates := []struct {
+		name   string
+		value  string
+		target *time.Time
+	}{
+		{"value date", *report.valueDate, &options.ValueDate},
+		{"forecast date", *report.forecast, &options.Forecast},
+		{"begin date", *report.begin, &options.Begin},
+		{"end date", *report.end, &options.End},
+	}
+	for _, date := range dates {
+		if date.value == "" {
+			continue
+		}
+		parsed, err := utils.ParseDate(date.value, report.dateFormat, time.Now().Year())
+		if err != nil {
+			return options, fmt.Errorf("Invalid %s %q, expected %s", date.name, date.value, utils.DatePattern(report.dateFormat))
+		}
+		*date.target = parsed
+	}
+
+	// Asking for the prices of a day means asking for market values
+	if !options.ValueDate.IsZero() {
+		options.Market = true
+	}
+
+	return options, nil
+}
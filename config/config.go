@@ -9,10 +9,17 @@ import (
 
 type Config struct {
 	DataFile   string            `yaml:"data_file"`
-	DateFormat string            `yaml:"date_format"`
+	PricesFile string            `yaml:"prices_file"` // extra P directives, relative to the data file
+	DateFormat string            `yaml:"date_format"` // Go layout dates are shown and written in, e.g. 2006/01/02 or 02.01.2006
 	Currency   string            `yaml:"currency"`
+	Strict     bool              `yaml:"strict"`     // only accounts declared with the account directive can be used
+	LotMethod  string            `yaml:"lot_method"` // fifo (default) or lifo, which lots a sale takes shares from
 	Aliases    map[string]string `yaml:"aliases"`
-	Theme      ThemeConfig       `yaml:"theme"`
+	// Account prefix to type (asset, liability, equity, income, expense), e.g. "checking: asset"
+	AccountTypes map[string]string `yaml:"account_types"`
+	// Monthly budget per account, e.g. "expenses:groceries: $400"
+	Budgets map[string]string `yaml:"budgets"`
+	Theme   ThemeConfig       `yaml:"theme"`
 }
 
 type ThemeConfig struct {
@@ -40,6 +47,14 @@ func DefaultConfig() *Config {
 	}
 }
 
+// The date format, the default one when the config has none
+func (config *Config) DateLayout() string {
+	if config.DateFormat == "" {
+		return "2006-01-02"
+	}
+	return config.DateFormat
+}
+
 func LoadConfig() (*Config, error) {
 
 	home, err := os.UserHomeDir()
@@ -0,0 +1,400 @@
+package decimal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"strings"
+)
+
+/**
+ * Decimal is an exact fixed-point number: value * 10^-scale.
+ *
+ * Money never goes through float64 anymore, so summing thousands of postings
+ * gives exactly the same result as doing it by hand. The coefficient is an
+ * int64, which leaves plenty of room for household amounts; anything that
+ * does not fit panics with ErrOverflow instead of silently drifting, and
+ * Recover turns that back into an error.
+ */
+type Decimal struct {
+	value int64
+	scale int32
+}
+
+// Results of multiplications and divisions are rounded to this many places, more are not read
+const MaxScale = 12
+
+var ErrOverflow = errors.New("number too large")
+
+/**
+ * Recover stops an ErrOverflow panic and puts it in err, call it deferred
+ * around arithmetic on numbers read from the user. Other panics go on.
+ */
+func Recover(err *error) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	if recoveredErr, isError := recovered.(error); isError && errors.Is(recoveredErr, ErrOverflow) {
+		*err = recoveredErr
+		return
+	}
+	panic(recovered)
+}
+
+func overflow(operation string) {
+	panic(fmt.Errorf("%w when %s", ErrOverflow, operation))
+}
+
+var Zero = Decimal{}
+
+var powersOfTen = func() [19]int64 {
+	var powers [19]int64
+	powers[0] = 1
+	for i := 1; i < len(powers); i++ {
+		powers[i] = powers[i-1] * 10
+	}
+	return powers
+}()
+
+func New(value int64, scale int32) Decimal {
+	if scale < 0 {
+		return Decimal{value: mustMul(value, pow10(-scale)), scale: 0}
+	}
+	return Decimal{value: value, scale: scale}
+}
+
+func NewFromInt(value int64) Decimal {
+	return Decimal{value: value}
+}
+
+/**
+ * Parse reads numbers like "1234", "-1,234.56", "+.5" or "0.10".
+ * Commas are accepted as thousands separators, between groups of three
+ * digits before the point: "1,50" is an error, not 150. At most MaxScale
+ * digits can follow the point.
+ */
+func Parse(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Zero, fmt.Errorf("empty number")
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	var value int64
+	var scale int32
+	digits := 0
+	seenPoint := false
+	group := -1 // digits since the last comma, -1 before the first one
+
+	for i := 0; i < len(s); i++ {
+		character := s[i]
+		switch {
+		case character >= '0' && character <= '9':
+			if value > (math.MaxInt64-int64(character-'0'))/10 {
+				return Zero, fmt.Errorf("number %q is too large", s)
+			}
+			value = value*10 + int64(character-'0')
+			digits++
+			if seenPoint {
+				scale++
+			} else if group >= 0 {
+				group++
+			}
+		case character == '.' && !seenPoint:
+			if group >= 0 && group != 3 {
+				return Zero, fmt.Errorf("invalid number %q, commas separate groups of three digits", s)
+			}
+			seenPoint = true
+		case character == ',' && !seenPoint:
+			if digits == 0 || (group >= 0 && group != 3) || (group < 0 && digits > 3) {
+				return Zero, fmt.Errorf("invalid number %q, commas separate groups of three digits", s)
+			}
+			group = 0
+		default:
+			return Zero, fmt.Errorf("invalid number %q", s)
+		}
+	}
+
+	if digits == 0 {
+		return Zero, fmt.Errorf("invalid number %q", s)
+	}
+	if !seenPoint && group >= 0 && group != 3 {
+		return Zero, fmt.Errorf("invalid number %q, commas separate groups of three digits", s)
+	}
+	if scale > MaxScale {
+		return Zero, fmt.Errorf("number %q has more than %d decimal places", s, MaxScale)
+	}
+
+	if negative {
+		value = -value
+	}
+
+	return Decimal{value: value, scale: scale}, nil
+}
+
+func MustParse(s string) Decimal {
+	d, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// Number of digits after the decimal point
+func (d Decimal) Scale() int32 {
+	return d.scale
+}
+
+// The digits without the decimal point, New(d.Coefficient(), d.Scale()) gives d back
+func (d Decimal) Coefficient() int64 {
+	return d.value
+}
+
+func (d Decimal) Sign() int {
+	switch {
+	case d.value < 0:
+		return -1
+	case d.value > 0:
+		return 1
+	}
+	return 0
+}
+
+func (d Decimal) IsZero() bool {
+	return d.value == 0
+}
+
+func (d Decimal) IsNegative() bool {
+	return d.value < 0
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{value: -d.value, scale: d.scale}
+}
+
+func (d Decimal) Abs() Decimal {
+	if d.value < 0 {
+		return d.Neg()
+	}
+	return d
+}
+
+func (d Decimal) Add(other Decimal) Decimal {
+	a, b := align(d, other)
+	result := a.value + b.value
+	// Overflow when both operands share a sign the result does not
+	if (a.value >= 0) == (b.value >= 0) && (result >= 0) != (a.value >= 0) {
+		overflow("adding")
+	}
+	return Decimal{value: result, scale: a.scale}
+}
+
+func (d Decimal) Sub(other Decimal) Decimal {
+	return d.Add(other.Neg())
+}
+
+// Multiplication is exact up to MaxScale decimal places
+func (d Decimal) Mul(other Decimal) Decimal {
+	result := new(big.Int).Mul(big.NewInt(d.value), big.NewInt(other.value))
+	return fromBig(result, d.scale+other.scale, MaxScale)
+}
+
+// Division rounds half away from zero to the given number of places
+func (d Decimal) Div(other Decimal, scale int32) Decimal {
+	if other.value == 0 {
+		panic("decimal: division by zero")
+	}
+
+	// d / other = (d.value * 10^(other.scale + scale - d.scale)) / other.value, at scale
+	numerator := big.NewInt(d.value)
+	shift := other.scale + scale - d.scale
+	denominator := big.NewInt(other.value)
+
+	if shift >= 0 {
+		numerator.Mul(numerator, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(shift)), nil))
+	} else {
+		denominator.Mul(denominator, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(-shift)), nil))
+	}
+
+	return Decimal{value: toInt64(divRound(numerator, denominator)), scale: scale}
+}
+
+// Round half away from zero to the given number of places
+func (d Decimal) Round(scale int32) Decimal {
+	if scale < 0 {
+		scale = 0
+	}
+	if d.scale <= scale {
+		return d
+	}
+	return fromBig(big.NewInt(d.value), d.scale, scale)
+}
+
+// Rescale without losing information, used to print with a fixed number of places
+func (d Decimal) Rescale(scale int32) Decimal {
+	if d.scale >= scale {
+		return d.Round(scale)
+	}
+	return Decimal{value: mustMul(d.value, pow10(scale-d.scale)), scale: scale}
+}
+
+// Drop trailing zeros after the decimal point
+func (d Decimal) Normalize() Decimal {
+	for d.scale > 0 && d.value%10 == 0 {
+		d.value /= 10
+		d.scale--
+	}
+	return d
+}
+
+// Comparing never overflows, numbers of different scales are lined up as big integers
+func (d Decimal) Cmp(other Decimal) int {
+	if d.scale == other.scale {
+		switch {
+		case d.value < other.value:
+			return -1
+		case d.value > other.value:
+			return 1
+		}
+		return 0
+	}
+
+	a, b := big.NewInt(d.value), big.NewInt(other.value)
+	if d.scale < other.scale {
+		a.Mul(a, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(other.scale-d.scale)), nil))
+	} else {
+		b.Mul(b, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(d.scale-other.scale)), nil))
+	}
+	return a.Cmp(b)
+}
+
+func (d Decimal) Equal(other Decimal) bool {
+	return d.Cmp(other) == 0
+}
+
+func (d Decimal) String() string {
+	negative := d.value < 0
+	digits := fmt.Sprintf("%d", d.value)
+	if negative {
+		digits = digits[1:]
+	}
+
+	if d.scale > 0 {
+		for int32(len(digits)) <= d.scale {
+			digits = "0" + digits
+		}
+		point := int32(len(digits)) - d.scale
+		digits = digits[:point] + "." + digits[point:]
+	}
+
+	if negative {
+		return "-" + digits
+	}
+	return digits
+}
+
+// Same as String but with thousands separators in the integer part
+func (d Decimal) StringGrouped() string {
+	s := d.String()
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+
+	integer, fraction := s, ""
+	if point := strings.IndexByte(s, '.'); point >= 0 {
+		integer, fraction = s[:point], s[point:]
+	}
+
+	var grouped strings.Builder
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+
+	return sign + grouped.String() + fraction
+}
+
+// Only for display purposes (charts, percentages), never for bookkeeping
+func (d Decimal) Float64() float64 {
+	return float64(d.value) / math.Pow10(int(d.scale))
+}
+
+/** Utils */
+
+func pow10(n int32) int64 {
+	if n < 0 || int(n) >= len(powersOfTen) {
+		overflow("lining up decimal places")
+	}
+	return powersOfTen[n]
+}
+
+func mustMul(a, b int64) int64 {
+	hi, lo := bits.Mul64(uint64(abs(a)), uint64(abs(b)))
+	if hi != 0 || lo > math.MaxInt64 {
+		overflow("lining up decimal places")
+	}
+	if (a < 0) != (b < 0) {
+		return -int64(lo)
+	}
+	return int64(lo)
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func align(a, b Decimal) (Decimal, Decimal) {
+	switch {
+	case a.scale < b.scale:
+		return a.Rescale(b.scale), b
+	case a.scale > b.scale:
+		return a, b.Rescale(a.scale)
+	}
+	return a, b
+}
+
+func fromBig(value *big.Int, scale, maxScale int32) Decimal {
+	if scale > maxScale {
+		divisor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale-maxScale)), nil)
+		value = divRound(value, divisor)
+		scale = maxScale
+	}
+	return Decimal{value: toInt64(value), scale: scale}
+}
+
+func divRound(numerator, denominator *big.Int) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(numerator, denominator, new(big.Int))
+	// Round half away from zero
+	if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(new(big.Int).Abs(denominator)) >= 0 {
+		if (numerator.Sign() < 0) != (denominator.Sign() < 0) {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	return quotient
+}
+
+func toInt64(value *big.Int) int64 {
+	if !value.IsInt64() {
+		overflow("multiplying or dividing")
+	}
+	return value.Int64()
+}
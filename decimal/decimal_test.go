@@ -0,0 +1,206 @@
+package decimal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		scale int32
+	}{
+		{"1234", "1234", 0},
+		{"-1,234.56", "-1234.56", 2},
+		{"+.5", "0.5", 1},
+		{"0.10", "0.10", 2},
+		{" 42 ", "42", 0},
+		{"1,234,567.891", "1234567.891", 3},
+		{"0.000000000001", "0.000000000001", 12},
+		{"9223372036854775807", "9223372036854775807", 0},
+	}
+
+	for _, test := range tests {
+		got, err := Parse(test.input)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", test.input, err)
+			continue
+		}
+		if got.String() != test.want || got.Scale() != test.scale {
+			t.Errorf("Parse(%q) = %s at scale %d, want %s at scale %d", test.input, got, got.Scale(), test.want, test.scale)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	inputs := []string{
+		"",
+		"-",
+		".",
+		"abc",
+		"1.2.3",
+		"1e5",
+		"9223372036854775808",
+		"0.0000000000001", // more than MaxScale places
+		"1.123456789012345678",
+	}
+
+	for _, input := range inputs {
+		if got, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) = %s, want an error", input, got)
+		}
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		input string
+		scale int32
+		want  string
+	}{
+		{"1.005", 2, "1.01"},
+		{"1.004", 2, "1.00"},
+		{"-1.005", 2, "-1.01"},
+		{"2.5", 0, "3"},
+		{"-2.5", 0, "-3"},
+		{"1.5", 3, "1.5"},
+		{"1.25", -1, "1"},
+	}
+
+	for _, test := range tests {
+		if got := MustParse(test.input).Round(test.scale).String(); got != test.want {
+			t.Errorf("%s.Round(%d) = %s, want %s", test.input, test.scale, got, test.want)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Decimal
+		want string
+	}{
+		{"add", MustParse("0.1").Add(MustParse("0.2")), "0.3"},
+		{"add scales", MustParse("10").Add(MustParse("0.05")), "10.05"},
+		{"sub", MustParse("1").Sub(MustParse("1.50")), "-0.50"},
+		{"mul", MustParse("2.5").Mul(MustParse("-0.4")), "-1.00"},
+		{"mul rounds to MaxScale", MustParse("0.000001").Mul(MustParse("0.0000015")), "0.000000000002"},
+		{"div", MustParse("10").Div(MustParse("3"), 4), "3.3333"},
+		{"div rounds half away from zero", MustParse("-2").Div(MustParse("3"), 2), "-0.67"},
+		{"rescale", MustParse("1.5").Rescale(3), "1.500"},
+		{"normalize", MustParse("1.500").Normalize(), "1.5"},
+	}
+
+	for _, test := range tests {
+		if got := test.got.String(); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCmp(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1", "1.00", 0},
+		{"-1", "0.5", -1},
+		{"10000000", "0.000000000001", 1},
+		{"-9223372036854775807", "0.000000000001", -1},
+	}
+
+	for _, test := range tests {
+		if got := MustParse(test.a).Cmp(MustParse(test.b)); got != test.want {
+			t.Errorf("Cmp(%s, %s) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	maximum := MustParse("9223372036854775807")
+
+	tests := []struct {
+		name      string
+		operation func() Decimal
+	}{
+		{"add", func() Decimal { return maximum.Add(MustParse("1")) }},
+		{"sub", func() Decimal { return maximum.Neg().Sub(MustParse("2")) }},
+		{"add lining up scales", func() Decimal { return MustParse("10000000").Add(MustParse("0.000000000001")) }},
+		{"mul", func() Decimal { return MustParse("9000000000").Mul(MustParse("9000000000")) }},
+		{"div", func() Decimal { return maximum.Div(MustParse("0.1"), 0) }},
+		{"rescale", func() Decimal { return maximum.Rescale(1) }},
+	}
+
+	for _, test := range tests {
+		err := func() (err error) {
+			defer Recover(&err)
+			test.operation()
+			return nil
+		}()
+		if !errors.Is(err, ErrOverflow) {
+			t.Errorf("%s: got %v, want ErrOverflow", test.name, err)
+		}
+	}
+}
+
+func TestRecoverLeavesOtherPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("division by zero did not panic")
+		}
+	}()
+
+	func() (err error) {
+		defer Recover(&err)
+		MustParse("1").Div(Zero, 2)
+		return nil
+	}()
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		value   Decimal
+		want    string
+		grouped string
+	}{
+		{New(0, 0), "0", "0"},
+		{New(5, 2), "0.05", "0.05"},
+		{New(-5, 3), "-0.005", "-0.005"},
+		{New(123456789, 2), "1234567.89", "1,234,567.89"},
+		{New(-1000, 0), "-1000", "-1,000"},
+		{New(12, -2), "1200", "1,200"},
+	}
+
+	for _, test := range tests {
+		if got := test.value.String(); got != test.want {
+			t.Errorf("String() = %s, want %s", got, test.want)
+		}
+		if got := test.value.StringGrouped(); got != test.grouped {
+			t.Errorf("StringGrouped() = %s, want %s", got, test.grouped)
+		}
+	}
+}
+
+func TestParseGrouping(t *testing.T) {
+	valid := map[string]string{
+		"1,234":         "1234",
+		"12,345,678":    "12345678",
+		"-999,999.5":    "-999999.5",
+		"1,000,000.000": "1000000.000",
+	}
+	for input, want := range valid {
+		got, err := Parse(input)
+		if err != nil || got.String() != want {
+			t.Errorf("Parse(%q) = %s, %v, want %s", input, got, err, want)
+		}
+	}
+
+	// A comma that is not between groups of three digits is a decimal comma or a typo, never dropped
+	invalid := []string{"1,50", "1,2,3", ",5", "1,", "1234,567", "1,234,56", "1,23.4", "1,2345", "1.234,5"}
+	for _, input := range invalid {
+		if got, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) = %s, want an error", input, got)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package Interpreter
+
+import (
+	"fmt"
+	AST "gledger/ast"
+	"strings"
+)
+
+// Top level names that need no declaration, the way the journal has always been written
+var defaultAccountTypes = map[string]AST.AccountType{
+	"assets":      AST.ACCOUNT_ASSET,
+	"asset":       AST.ACCOUNT_ASSET,
+	"liabilities": AST.ACCOUNT_LIABILITY,
+	"liability":   AST.ACCOUNT_LIABILITY,
+	"equity":      AST.ACCOUNT_EQUITY,
+	"income":      AST.ACCOUNT_INCOME,
+	"revenue":     AST.ACCOUNT_INCOME,
+	"revenues":    AST.ACCOUNT_INCOME,
+	"expenses":    AST.ACCOUNT_EXPENSE,
+	"expense":     AST.ACCOUNT_EXPENSE,
+}
+
+/**
+ * The type of an account, first match wins:
+ *
+ *   1. an account directive with a type, for the account or one of its parents
+ *   2. the account_types mapping in the config, longest prefix first
+ *   3. the usual top level names (assets, liabilities, equity, income, expenses)
+ *
+ * Anything else is ACCOUNT_UNKNOWN and shows up under "Other" in reports.
+ */
+func (interpreter *Interpreter) AccountType(account string) AST.AccountType {
+	for name := account; name != ""; name = parentAccount(name) {
+		if accountType := interpreter.accounts[name]; accountType != AST.ACCOUNT_UNKNOWN {
+			return accountType
+		}
+	}
+
+	for name := account; name != ""; name = parentAccount(name) {
+		if typeName, exists := interpreter.config.AccountTypes[name]; exists {
+			if accountType, err := AST.ParseAccountType(typeName); err == nil {
+				return accountType
+			}
+		}
+	}
+
+	top, _, _ := strings.Cut(account, ":")
+	return defaultAccountTypes[strings.ToLower(top)]
+}
+
+func (interpreter *Interpreter) checkAccountTypes() error {
+	for account, typeName := range interpreter.config.AccountTypes {
+		if _, err := AST.ParseAccountType(typeName); err != nil {
+			return fmt.Errorf("Invalid account type for %s in config: %v", account, err)
+		}
+	}
+	return nil
+}
+
+// expenses:food:groceries -> expenses:food -> expenses -> ""
+func parentAccount(account string) string {
+	if separator := strings.LastIndex(account, ":"); separator >= 0 {
+		return account[:separator]
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+package Interpreter
+
+import (
+	"fmt"
+	AST "gledger/ast"
+	"sort"
+	"strings"
+)
+
+/**
+ * Balance assertions (assets:checking  -$45.32 = $1,204.18) state what the
+ * account holds in that commodity right after the posting. Balance
+ * assignments (assets:cash  = $200) state only that, and get whatever
+ * amount is needed to reach it.
+ *
+ * Both are worked out in date order, transactions on the same day in the
+ * order they were read. Automated transactions are applied to transactions
+ * with balance assignments here, once the amounts they go by are known.
+ */
+func (interpreter *Interpreter) checkBalances(transactions []*AST.Transaction) error {
+	ordered := append([]*AST.Transaction{}, transactions...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Date.Before(ordered[j].Date)
+	})
+
+	running := map[string]AST.Balance{}
+	var failures []string
+
+	for _, transaction := range ordered {
+		if transaction.HasBalanceAssignments() {
+			if err := applyBalanceAssignments(transaction, running); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", transaction.Position, err))
+				continue
+			}
+			if err := interpreter.applyAutomated(transaction); err != nil {
+				failures = append(failures, err.Error())
+				continue
+			}
+		}
+
+		for _, posting := range transaction.Postings {
+			if running[posting.Account] == nil {
+				running[posting.Account] = AST.Balance{}
+			}
+			running[posting.Account].Add(posting.Amount)
+
+			if posting.Assertion == nil {
+				continue
+			}
+
+			expected := *posting.Assertion
+			actual := balanceIn(running[posting.Account], expected)
+
+			// Exact, $0.40 is not $0 however the assertion was written
+			if !actual.Value.Equal(expected.Value) {
+				failures = append(failures, fmt.Sprintf("%s: balance assertion failed for %s: expected %s, actual %s",
+					posting.Position, posting.Account, expected.String(), actual.String()))
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%s", strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+/**
+ * Work out the amount of every assigned posting from the running balances,
+ * then let an elided posting take up the difference.
+ */
+func applyBalanceAssignments(transaction *AST.Transaction, running map[string]AST.Balance) error {
+	transaction.ResetInferredAmounts()
+
+	// Earlier postings of the same transaction count too
+	pending := map[string]AST.Balance{}
+	for i := range transaction.Postings {
+		posting := &transaction.Postings[i]
+		if pending[posting.Account] == nil {
+			pending[posting.Account] = AST.Balance{}
+		}
+
+		if posting.Assigned {
+			target := *posting.Assertion
+			current := balanceIn(running[posting.Account], target).Value.Add(balanceIn(pending[posting.Account], target).Value)
+
+			posting.Amount = target
+			posting.Amount.Value = target.Value.Sub(current)
+		}
+
+		if !posting.Elided {
+			pending[posting.Account].Add(posting.Amount)
+		}
+	}
+
+	if err := transaction.InferElidedAmounts(); err != nil {
+		return err
+	}
+
+	if !transaction.IsBalanced() {
+		return fmt.Errorf("Transaction is not balanced (sum: %s)", transaction.Imbalance())
+	}
+
+	return nil
+}
+
+// The amount of the balance in the commodity of reference, zero when there is none
+func balanceIn(balance AST.Balance, reference AST.Amount) AST.Amount {
+	if amount, exists := balance[reference.Commodity]; exists {
+		return amount
+	}
+	return AST.Amount{Commodity: reference.Commodity, Style: reference.Style}
+}
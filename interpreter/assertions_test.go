@@ -0,0 +1,140 @@
+package Interpreter
+
+import (
+	AST "gledger/ast"
+	Parser "gledger/parser"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const openingBalance = `2025-01-01 Opening
+    assets:checking        $100.40
+    equity:opening
+
+`
+
+func TestBalanceAssertionHolds(t *testing.T) {
+	_, err := loadText(t, openingBalance+`2025-01-02 Rent
+    assets:checking        -$100.00 = $0.40
+    expenses:rent
+
+2025-01-03 Check
+    assets:checking        $0 = $0.40
+    expenses:rent
+`)
+	if err != nil {
+		t.Fatalf("an assertion that holds failed: %v", err)
+	}
+}
+
+func TestBalanceAssertionFails(t *testing.T) {
+	_, err := loadText(t, openingBalance+`2025-01-02 Rent
+    assets:checking        -$50.00 = $40.00
+    expenses:rent
+`)
+	if err == nil {
+		t.Fatal("a wrong assertion was accepted")
+	}
+	want := "balance assertion failed for assets:checking: expected $40.00, actual $50.40"
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("got %q, want it to say %q", err, want)
+	}
+	if !strings.Contains(err.Error(), "main.journal:6") {
+		t.Errorf("got %q, want the line of the posting", err)
+	}
+}
+
+// The amount is compared exactly, $0.40 left does not round to the $0 asserted
+func TestBalanceAssertionDoesNotRound(t *testing.T) {
+	_, err := loadText(t, openingBalance+`2025-01-02 Rent
+    assets:checking        -$100.00 = $0
+    expenses:rent
+`)
+	if err == nil {
+		t.Fatal("$0.40 was taken for $0")
+	}
+	if want := "expected $0, actual $0.40"; !strings.Contains(err.Error(), want) {
+		t.Errorf("got %q, want it to say %q", err, want)
+	}
+}
+
+// The account and amount of every posting, to compare with what is expected
+func postingsOf(transaction *AST.Transaction) []string {
+	var postings []string
+	for _, posting := range transaction.Postings {
+		postings = append(postings, posting.Account+" "+posting.Amount.String())
+	}
+	return postings
+}
+
+func checkPostings(t *testing.T, interpreter *Interpreter, want map[string][]string) {
+	t.Helper()
+	for _, transaction := range interpreter.transactions {
+		expected, exists := want[transaction.Description]
+		if !exists {
+			continue
+		}
+		if got := postingsOf(transaction); !slices.Equal(got, expected) {
+			t.Errorf("%s has postings %q, want %q", transaction.Description, got, expected)
+		}
+	}
+}
+
+// An assignment gets what brings the account to its balance, the elided posting the rest
+func TestBalanceAssignments(t *testing.T) {
+	interpreter, err := loadText(t, `2025-01-01 Opening
+    assets:cash            = $200.00
+    equity:opening
+
+2025-01-10 Cash count
+    assets:cash            = $180.00
+    expenses:unknown
+
+2025-01-05 Lunch
+    expenses:dining        $12.50
+    assets:cash
+
+2025-01-12 Exchange
+    assets:cash            $-20.00
+    assets:cash            = EUR 50
+    assets:cash            = $150.00
+    equity:exchange
+`)
+	if err != nil {
+		t.Fatalf("loading failed: %v", err)
+	}
+
+	// The count goes by the lunch, read after it but dated before. Later postings see earlier ones of the same transaction
+	checkPostings(t, interpreter, map[string][]string{
+		"Opening":    {"assets:cash $200.00", "equity:opening -$200.00"},
+		"Cash count": {"assets:cash -$7.50", "expenses:unknown $7.50"},
+		"Exchange":   {"assets:cash -$20.00", "assets:cash EUR 50", "assets:cash -$10.00", "equity:exchange -EUR 50", "equity:exchange $30.00"},
+	})
+}
+
+// A transaction added before an assignment changes what the assignment works out to
+func TestBalanceAssignmentAfterAdd(t *testing.T) {
+	interpreter, err := loadText(t, `2025-01-01 Opening
+    assets:cash            $200.00
+    equity:opening
+
+2025-01-10 Cash count
+    assets:cash            = $180.00
+    expenses:unknown
+`)
+	if err != nil {
+		t.Fatalf("loading failed: %v", err)
+	}
+
+	added, err := Parser.ParseTransactions("2025-01-05 Lunch\n    expenses:dining    $12.50\n    assets:cash\n", Parser.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := interpreter.AddTransaction(added[0]); err != nil {
+		t.Fatalf("adding failed: %v", err)
+	}
+	checkPostings(t, interpreter, map[string][]string{
+		"Cash count": {"assets:cash -$7.50", "expenses:unknown $7.50"},
+	})
+}
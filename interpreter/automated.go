@@ -0,0 +1,40 @@
+package Interpreter
+
+import (
+	"fmt"
+	AST "gledger/ast"
+)
+
+func (interpreter *Interpreter) GetAutomatedTransactions() []*AST.AutomatedTransaction {
+	return interpreter.automated
+}
+
+/**
+ * Add the postings of every automated transaction matching one of the
+ * postings of transaction. Generated postings are marked, they never match
+ * themselves and are not written back to the journal. Transactions with
+ * balance assignments get them from checkBalances, their amounts are not
+ * known before.
+ */
+func (interpreter *Interpreter) applyAutomated(transaction *AST.Transaction) error {
+	var generated []AST.Posting
+	for _, automated := range interpreter.automated {
+		for i := range transaction.Postings {
+			posting := &transaction.Postings[i]
+			if posting.Generated || !automated.Matches(posting.Account) {
+				continue
+			}
+			generated = append(generated, automated.Apply(posting)...)
+		}
+	}
+
+	if len(generated) == 0 {
+		return nil
+	}
+
+	transaction.Postings = append(transaction.Postings, generated...)
+	if !transaction.IsBalanced() {
+		return fmt.Errorf("%s: automated postings leave the transaction unbalanced (sum: %s)", transaction.Position, transaction.Balance())
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package Interpreter
+
+import (
+	Parser "gledger/parser"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Automated postings go by the amounts balance assignments work out
+func TestAutomatedWithBalanceAssignments(t *testing.T) {
+	interpreter, err := loadText(t, `= expenses:dining
+    (budget:dining)        -1.0
+
+= assets:cash
+    (budget:cash)          1.0
+
+2025-01-01 Opening
+    assets:checking        $-3,500.00
+    equity:opening
+
+2025-01-05 Dinner
+    expenses:dining        $45.32
+    assets:checking        = $-3,545.32
+
+2025-01-06 Withdrawal
+    assets:cash            = $200.00
+    assets:checking
+`)
+	if err != nil {
+		t.Fatalf("loading failed: %v", err)
+	}
+
+	want := map[string][]string{
+		"Dinner":     {"expenses:dining $45.32", "assets:checking -$45.32", "budget:dining -$45.32"},
+		"Withdrawal": {"assets:cash $200.00", "assets:checking -$200.00", "budget:cash $200.00"},
+	}
+	check := func(when string) {
+		for _, transaction := range interpreter.transactions {
+			expected, exists := want[transaction.Description]
+			if !exists {
+				continue
+			}
+			var got []string
+			for _, posting := range transaction.Postings {
+				got = append(got, posting.Account+" "+posting.Amount.String())
+			}
+			if !slices.Equal(got, expected) {
+				t.Errorf("%s: %s has postings %q, want %q", when, transaction.Description, got, expected)
+			}
+		}
+	}
+	check("after loading")
+
+	// Adding a transaction works the assignments out again, the automated postings are not added twice
+	if err := interpreter.checkBalances(interpreter.transactions); err != nil {
+		t.Fatalf("checking the balances again failed: %v", err)
+	}
+	check("checked again")
+}
+
+const automatedJournal = `= expenses:dining
+    (budget:dining)        -1.0
+
+= /^income:salary$/
+    assets:savings         -0.1
+    assets:checking        0.1
+
+= expenses:rent
+    (envelope:rent)        $-10.00
+
+= budget:dining
+    (budget:never)         1.0
+
+2025-01-05 Dinner
+    expenses:dining:out    $45.32
+    assets:checking
+
+2025-01-31 Salary
+    assets:checking        $3,000.00
+    income:salary
+
+2025-02-01 Rent
+    expenses:rent          $1,500.00
+    assets:checking
+`
+
+/**
+ * An account matches its sub-accounts, a pattern what it matches. Amounts
+ * without a commodity multiply the matched amount, the others are added as
+ * they are. Generated postings do not match any rule.
+ */
+func TestAutomatedTransactions(t *testing.T) {
+	interpreter, err := loadText(t, automatedJournal)
+	if err != nil {
+		t.Fatalf("loading failed: %v", err)
+	}
+
+	checkPostings(t, interpreter, map[string][]string{
+		"Dinner": {"expenses:dining:out $45.32", "assets:checking -$45.32", "budget:dining -$45.32"},
+		"Salary": {"assets:checking $3,000.00", "income:salary -$3,000.00", "assets:savings $300.00", "assets:checking -$300.00"},
+		"Rent":   {"expenses:rent $1,500.00", "assets:checking -$1,500.00", "envelope:rent -$10.00"},
+	})
+
+	// The rules add their postings after the two that were written
+	for _, transaction := range interpreter.transactions {
+		for i, posting := range transaction.Postings {
+			if posting.Generated != (i >= 2) {
+				t.Errorf("%s: %s has Generated %t", transaction.Description, posting.Account, posting.Generated)
+			}
+		}
+	}
+}
+
+// Generated postings stay out of the journal, also for transactions added later
+func TestAutomatedNotSaved(t *testing.T) {
+	interpreter, err := loadText(t, automatedJournal)
+	if err != nil {
+		t.Fatalf("loading failed: %v", err)
+	}
+
+	added, err := Parser.ParseTransactions("2025-02-05 Lunch\n    expenses:dining    $12.00\n    assets:checking\n", Parser.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := interpreter.AddTransaction(added[0]); err != nil {
+		t.Fatalf("adding failed: %v", err)
+	}
+	checkPostings(t, interpreter, map[string][]string{
+		"Lunch": {"expenses:dining $12.00", "assets:checking -$12.00", "budget:dining -$12.00"},
+	})
+
+	filename := filepath.Join(t.TempDir(), "saved.journal")
+	if err := interpreter.SaveToFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(saved), automatedJournal) {
+		t.Errorf("the journal was not written back as it was read:\n%s", saved)
+	}
+	// Only the rules name the accounts they post to
+	for account, rules := range map[string]int{"budget:dining": 2, "assets:savings": 1, "envelope:rent": 1} {
+		if count := strings.Count(string(saved), account); count != rules {
+			t.Errorf("%s is in the saved journal %d times, want %d:\n%s", account, count, rules, saved)
+		}
+	}
+}
+
+func TestAutomatedUnbalanced(t *testing.T) {
+	_, err := loadText(t, `= expenses:gifts
+    assets:savings         -0.1
+
+2025-03-01 Present
+    expenses:gifts         $50.00
+    assets:checking
+`)
+	if err == nil || !strings.Contains(err.Error(), "automated postings leave the transaction unbalanced") {
+		t.Errorf("got %v, want an error about the unbalanced transaction", err)
+	}
+}
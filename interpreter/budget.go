@@ -0,0 +1,243 @@
+package Interpreter
+
+import (
+	"fmt"
+	AST "gledger/ast"
+	"gledger/decimal"
+	"gledger/utils"
+	"sort"
+	"strings"
+	"time"
+)
+
+/**
+ * Budgets come from the amounts written on periodic transactions
+ * (~ monthly ...) and from the budgets section of the config, which are
+ * monthly amounts per account. The posting left without an amount, usually
+ * the account the money comes from, is not a budget.
+ */
+
+/**
+ * BudgetOptions is a report split in periods, monthly unless said otherwise.
+ * The first period contains Begin, or the first posting, and the last one
+ * ends on End, or after the last posting.
+ */
+type BudgetOptions struct {
+	ReportOptions
+	Interval AST.Period // only the unit and count are used
+}
+
+type BudgetLine struct {
+	Account  string
+	Budgeted AST.Balance // including the budgets of sub-accounts
+	Actual   AST.Balance // including the postings to sub-accounts
+}
+
+type BudgetPeriod struct {
+	Start time.Time
+	End   time.Time // exclusive
+	Lines []BudgetLine
+}
+
+// Config budgets as periodic transactions, so both sources are worked out the same way
+func (interpreter *Interpreter) loadBudgets() error {
+	interpreter.budgets = nil
+
+	var accounts []string
+	for account := range interpreter.config.Budgets {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+
+	for _, account := range accounts {
+		written := interpreter.config.Budgets[account]
+		amount, err := utils.ParseAmount(written)
+		if err != nil {
+			return fmt.Errorf("Invalid budget for %s in config: %v", account, err)
+		}
+		amount = utils.WithDefaultCommodity(amount, interpreter.config.Currency)
+
+		interpreter.budgets = append(interpreter.budgets, &AST.PeriodicTransaction{
+			Period: AST.Period{Expression: "monthly", Unit: AST.PERIOD_MONTH, Count: 1},
+			Transaction: &AST.Transaction{
+				Description: "Budget",
+				Postings:    []AST.Posting{{Account: account, Amount: amount}},
+			},
+		})
+	}
+
+	return nil
+}
+
+// Budgeted amounts per account for the occurrences from start to end
+func (interpreter *Interpreter) budgetedAmounts(start, end time.Time) map[string]AST.Balance {
+	budgeted := map[string]AST.Balance{}
+
+	for _, periodic := range append(append([]*AST.PeriodicTransaction{}, interpreter.periodic...), interpreter.budgets...) {
+		occurrences := len(periodic.Period.Occurrences(start, end))
+		if occurrences == 0 {
+			continue
+		}
+
+		for _, posting := range periodic.Transaction.Postings {
+			if posting.Elided {
+				continue
+			}
+			if budgeted[posting.Account] == nil {
+				budgeted[posting.Account] = AST.Balance{}
+			}
+			amount := posting.Amount
+			amount.Value = amount.Value.Mul(decimal.NewFromInt(int64(occurrences)))
+			budgeted[posting.Account].Add(amount)
+		}
+	}
+
+	return budgeted
+}
+
+/**
+ * Budgeted and actual amounts per period. Every account with a budget is
+ * listed together with its parents, and a parent adds up everything
+ * budgeted and spent below it.
+ */
+func (interpreter *Interpreter) CalculateBudget(options BudgetOptions) []BudgetPeriod {
+	interval := options.Interval
+	if interval.Count == 0 {
+		interval = AST.Period{Unit: AST.PERIOD_MONTH, Count: 1}
+	}
+	interval.Start, interval.End = time.Time{}, time.Time{}
+
+	transactions := interpreter.FilterTransactions(options.ReportOptions)
+
+	begin, end := options.Begin, options.End
+	for _, transaction := range transactions {
+		for i := range transaction.Postings {
+			date := transaction.PostingDate(&transaction.Postings[i], options.Effective)
+			if options.Begin.IsZero() && (begin.IsZero() || date.Before(begin)) {
+				begin = date
+			}
+			if options.End.IsZero() && !date.Before(end) {
+				end = date.AddDate(0, 0, 1)
+			}
+		}
+	}
+	if begin.IsZero() {
+		now := time.Now()
+		begin = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	if end.IsZero() || !end.After(begin) {
+		end = interval.Next(interval.Align(begin))
+	}
+
+	var periods []BudgetPeriod
+	for start := interval.Align(begin); start.Before(end); start = interval.Next(start) {
+		period := BudgetPeriod{Start: start, End: interval.Next(start)}
+
+		budgeted := interpreter.budgetedAmounts(period.Start, period.End)
+		if len(budgeted) == 0 {
+			periods = append(periods, period)
+			continue
+		}
+
+		var accounts []string
+		for account := range budgeted {
+			accounts = append(accounts, account)
+		}
+		sort.Strings(accounts)
+
+		// The budgeted accounts and their parents
+		lines := map[string]*BudgetLine{}
+		for _, account := range accounts {
+			for name := account; name != ""; name = parentAccount(name) {
+				if lines[name] == nil {
+					lines[name] = &BudgetLine{Account: name, Budgeted: AST.Balance{}, Actual: AST.Balance{}}
+				}
+				lines[name].Budgeted.AddBalance(budgeted[account])
+			}
+		}
+
+		for _, transaction := range transactions {
+			for i := range transaction.Postings {
+				posting := &transaction.Postings[i]
+				date := transaction.PostingDate(posting, options.Effective)
+				if date.Before(period.Start) || !date.Before(period.End) || !options.MatchesPosting(transaction, posting) {
+					continue
+				}
+				for name := posting.Account; name != ""; name = parentAccount(name) {
+					if line := lines[name]; line != nil {
+						line.Actual.Add(posting.Amount)
+					}
+				}
+			}
+		}
+
+		var names []string
+		for name := range lines {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			period.Lines = append(period.Lines, *lines[name])
+		}
+		periods = append(periods, period)
+	}
+
+	return periods
+}
+
+func (interpreter *Interpreter) GenerateBudgetReport(options BudgetOptions) string {
+	var report strings.Builder
+	report.WriteString("BUDGET REPORT\n")
+	report.WriteString("══════════════════════════════════════════════\n\n")
+
+	for _, period := range interpreter.CalculateBudget(options) {
+		report.WriteString(fmt.Sprintf("%s to %s:\n", interpreter.formatDate(period.Start), interpreter.formatDate(period.End.AddDate(0, 0, -1))))
+
+		if len(period.Lines) == 0 {
+			report.WriteString("  No budget for this period\n\n")
+			continue
+		}
+
+		report.WriteString(fmt.Sprintf("  %-32s %12s %12s %12s %6s\n", "Account", "Budgeted", "Actual", "Remaining", "Used"))
+		for _, line := range period.Lines {
+			writeBudgetLines(&report, line)
+		}
+		report.WriteString("\n")
+	}
+
+	return report.String()
+}
+
+// One line per commodity of the budget, actual amounts in other commodities get their own line
+func writeBudgetLines(report *strings.Builder, line BudgetLine) {
+	commodities := line.Budgeted.Commodities()
+	for _, commodity := range line.Actual.Commodities() {
+		if _, budgeted := line.Budgeted[commodity]; !budgeted {
+			commodities = append(commodities, commodity)
+		}
+	}
+
+	name := line.Account
+	for _, commodity := range commodities {
+		budgeted, hasBudget := line.Budgeted[commodity]
+		actual, hasActual := line.Actual[commodity]
+		if !hasBudget {
+			budgeted = AST.Amount{Value: decimal.Zero.Rescale(actual.Value.Scale()), Commodity: commodity, Style: actual.Style}
+		}
+		if !hasActual {
+			actual = AST.Amount{Value: decimal.Zero.Rescale(budgeted.Value.Scale()), Commodity: commodity, Style: budgeted.Style}
+		}
+
+		remaining := budgeted
+		remaining.Value = budgeted.Value.Sub(actual.Value)
+
+		used := "-"
+		if !budgeted.Value.IsZero() {
+			used = fmt.Sprintf("%.0f%%", actual.Value.Div(budgeted.Value, 4).Float64()*100)
+		}
+
+		report.WriteString(fmt.Sprintf("  %-32s %12s %12s %12s %6s\n", name, budgeted.String(), actual.String(), remaining.String(), used))
+		name = ""
+	}
+}
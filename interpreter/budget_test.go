@@ -0,0 +1,96 @@
+package Interpreter
+
+import (
+	"fmt"
+	"gledger/config"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const budgetJournal = `~ monthly
+    expenses:food:groceries    $400.00
+    expenses:food:dining       $100.00
+    assets:checking
+
+2025-01-01 Rent
+    expenses:rent              $1,500.00
+    assets:checking
+
+2025-01-05 Groceries
+    expenses:food:groceries    $120.00
+    assets:checking
+
+2025-01-20 Dinner
+    expenses:food:dining       $150.00
+    assets:checking
+
+2025-02-03 Groceries
+    expenses:food:groceries    $380.00
+    assets:checking
+`
+
+func loadBudget(t *testing.T) *Interpreter {
+	t.Helper()
+	settings := config.DefaultConfig()
+	settings.Budgets = map[string]string{"expenses:rent": "$1,500.00"}
+
+	interpreter, err := loadTextWith(t, settings, budgetJournal)
+	if err != nil {
+		t.Fatalf("loading failed: %v", err)
+	}
+	return interpreter
+}
+
+/**
+ * Periodic transactions and the config both budget, the elided posting does
+ * not. Parents add up the budgets and postings below them.
+ */
+func TestCalculateBudget(t *testing.T) {
+	periods := loadBudget(t).CalculateBudget(BudgetOptions{})
+
+	want := map[string][]string{
+		"2025-01-01": {
+			"expenses $2000.00 / $1,770.00",
+			"expenses:food $500.00 / $270.00",
+			"expenses:food:dining $100.00 / $150.00",
+			"expenses:food:groceries $400.00 / $120.00",
+			"expenses:rent $1,500.00 / $1,500.00",
+		},
+		"2025-02-01": {
+			"expenses $2000.00 / $380.00",
+			"expenses:food $500.00 / $380.00",
+			"expenses:food:dining $100.00 / 0",
+			"expenses:food:groceries $400.00 / $380.00",
+			"expenses:rent $1,500.00 / 0",
+		},
+	}
+	if len(periods) != len(want) {
+		t.Fatalf("got %d periods, want %d", len(periods), len(want))
+	}
+	for _, period := range periods {
+		start := period.Start.Format("2006-01-02")
+		var lines []string
+		for _, line := range period.Lines {
+			lines = append(lines, fmt.Sprintf("%s %s / %s", line.Account, line.Budgeted.String(), line.Actual.String()))
+		}
+		if !slices.Equal(lines, want[start]) {
+			t.Errorf("period from %s has lines %q, want %q", start, lines, want[start])
+		}
+	}
+}
+
+// Remaining and used go by the budget, more than budgeted is over 100%
+func TestBudgetReport(t *testing.T) {
+	report := loadBudget(t).GenerateBudgetReport(BudgetOptions{})
+
+	for _, want := range []string{
+		fmt.Sprintf("  %-32s %12s %12s %12s %6s\n", "expenses:food:dining", "$100.00", "$150.00", "-$50.00", "150%"),
+		fmt.Sprintf("  %-32s %12s %12s %12s %6s\n", "expenses:food:groceries", "$400.00", "$120.00", "$280.00", "30%"),
+		fmt.Sprintf("  %-32s %12s %12s %12s %6s\n", "expenses:rent", "$1,500.00", "$0.00", "$1,500.00", "0%"),
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("the report has no line %q:\n%s", want, report)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package Interpreter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	AST "gledger/ast"
+	Parser "gledger/parser"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+/**
+ * Parsed journals are kept in the user cache directory, so a report on a
+ * journal that did not change skips the parser and one that only grew at
+ * the end parses the new part. An entry is checked against the size and
+ * the content hash of its file, which is read anyway to cut out the text of
+ * the items. A missing or broken entry only means parsing again.
+ *
+ * Next to them a ledger entry keeps what loading worked out from all the
+ * journals: the postings of automated transactions and balance assignments,
+ * the transactions in date order, the declared accounts, prices, lots and
+ * gains. It refers to the entries of the journals by hash and is used as a
+ * whole when every journal still has that hash and every include matches
+ * the same files,
+ * loading then neither parses nor goes over the transactions.
+ */
+
+// Bump when the AST, its encoding or what the parser accepts change, older entries are then ignored
+const cacheVersion = 3
+
+type cacheEntry struct {
+	Version  int
+	Path     string
+	Size     int64
+	Hash     []byte // sha256 of the content
+	Settings string // everything else the parser result depends on
+	Items    []*AST.Item
+}
+
+type ledgerEntry struct {
+	Version  int
+	Path     string // the main journal
+	Settings string
+	Files    []cachedFile // every journal loaded, in the order of ledger.journals
+	Includes []includeMatch
+}
+
+// A journal the way it was when it was read, Hash is that of its content and its cache entry
+type cachedFile struct {
+	Path string
+	Size int64
+	Hash []byte
+}
+
+// The files an include pattern matched, a new one means loading again
+type includeMatch struct {
+	Pattern string
+	Matches []string
+}
+
+/**
+ * Parse filename, with the help of its cache entry when there is one. The
+ * accounts the file declares go into options.Accounts like when it is parsed.
+ * The size returned is from before it was read.
+ */
+func parseCached(filename string, options Parser.Options) (*AST.Journal, cachedFile, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, cachedFile{}, fmt.Errorf("Error reading file: %v", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, cachedFile{}, fmt.Errorf("Error reading file: %v", err)
+	}
+
+	settings := parserSettings(options)
+	journal := &AST.Journal{File: filename}
+	read := cachedFile{Path: filename, Size: info.Size()}
+
+	if cached, reader := readCache(filename); cached != nil && cached.Settings == settings && cached.Size <= info.Size() {
+		content, prefix, hash, err := readHashed(file, info.Size(), cached.Size)
+		if err != nil {
+			return nil, cachedFile{}, fmt.Errorf("Error reading file: %v", err)
+		}
+		read.Hash = hash
+
+		// What was cached is still the start of the file: it is all of it or something was appended
+		if bytes.Equal(prefix, cached.Hash) {
+			if items, err := reader.decodeItems(content); err == nil {
+				if cached.Size == int64(len(content)) {
+					journal.Items = items
+					if err := Parser.ApplyDirectives(journal.Items, &options); err != nil {
+						return nil, cachedFile{}, err
+					}
+					return journal, read, nil
+				}
+
+				if len(items) > 0 {
+					if err := parseAppended(journal, items, content, options); err != nil {
+						return nil, cachedFile{}, err
+					}
+					writeCache(journal, read, settings)
+					return journal, read, nil
+				}
+			}
+		}
+
+		if err := parseInto(journal, strings.NewReader(content), options); err != nil {
+			return nil, cachedFile{}, err
+		}
+		writeCache(journal, read, settings)
+		return journal, read, nil
+	}
+
+	// Everything is parsed, the hash is worked out on the way
+	hasher := sha256.New()
+	if err := parseInto(journal, io.TeeReader(file, hasher), options); err != nil {
+		return nil, cachedFile{}, err
+	}
+	read.Hash = hasher.Sum(nil)
+	writeCache(journal, read, settings)
+	return journal, read, nil
+}
+
+// The last cached item is parsed again with what comes after it, what was appended can belong to it
+func parseAppended(journal *AST.Journal, cached []*AST.Item, content string, options Parser.Options) error {
+	last := cached[len(cached)-1]
+	journal.Items = cached[:len(cached)-1]
+	if err := Parser.ApplyDirectives(journal.Items, &options); err != nil {
+		return err
+	}
+
+	offset := 0
+	for _, item := range journal.Items {
+		offset += len(item.Text)
+	}
+	options.Line = last.Line
+	return parseInto(journal, strings.NewReader(content[offset:]), options)
+}
+
+func parseInto(journal *AST.Journal, reader io.Reader, options Parser.Options) error {
+	err := Parser.ParseReader(reader, options, func(item *AST.Item) error {
+		journal.Items = append(journal.Items, item)
+		return nil
+	})
+	if _, isDiagnostics := err.(Parser.Diagnostics); isDiagnostics {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("Error reading file: %v", err)
+	}
+	return nil
+}
+
+// Yearless dates depend on the current year. Loading parses without the strict check, it does it itself
+func parserSettings(options Parser.Options) string {
+	year := options.Year
+	if year == 0 {
+		year = time.Now().Year()
+	}
+	return fmt.Sprintf("date_format=%q year=%d", options.DateFormat, year)
+}
+
+func cacheFile(filename string) (string, error) {
+	directory, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	key := sha256.Sum256([]byte(filename))
+	return filepath.Join(directory, "gledger", hex.EncodeToString(key[:16])), nil
+}
+
+// The entry of filename, nil when there is none or it cannot be used
+func readCache(filename string) (*cacheEntry, *cacheReader) {
+	path, err := cacheFile(filename)
+	if err != nil {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil
+	}
+
+	entry, reader, err := decodeCache(data)
+	if err != nil || entry.Path != filename {
+		return nil, nil
+	}
+	return entry, reader
+}
+
+// The entry is skipped when the file changed while it was read
+func writeCache(journal *AST.Journal, read cachedFile, settings string) {
+	if textSize(journal) != read.Size {
+		return
+	}
+
+	path, err := cacheFile(journal.File)
+	if err != nil {
+		return
+	}
+
+	replaceFile(path, encodeCache(&cacheEntry{
+		Path:     journal.File,
+		Size:     read.Size,
+		Hash:     read.Hash,
+		Settings: settings,
+		Items:    journal.Items,
+	}))
+}
+
+func textSize(journal *AST.Journal) int64 {
+	size := int64(0)
+	for _, item := range journal.Items {
+		size += int64(len(item.Text))
+	}
+	return size
+}
+
+// Strict mode and lot methods change what loading works out, the rest is what the parser depends on
+func ledgerSettings(options Parser.Options, method LotMethod) string {
+	return fmt.Sprintf("%s strict=%t lot_method=%d", parserSettings(options), options.Strict, method)
+}
+
+func ledgerFile(filename string) (string, error) {
+	path, err := cacheFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return path + ".ledger", nil
+}
+
+// The ledger of filename as the last load left it, nil when a journal changed since
+func readLedger(filename, settings string) *loadedLedger {
+	path, err := ledgerFile(filename)
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	entry, reader, err := decodeLedgerEntry(data)
+	if err != nil || entry.Path != filename || entry.Settings != settings {
+		return nil
+	}
+
+	for _, include := range entry.Includes {
+		matches, err := filepath.Glob(include.Pattern)
+		if err != nil || !slices.Equal(matches, include.Matches) {
+			return nil
+		}
+	}
+
+	journals := make([]*AST.Journal, len(entry.Files))
+	for i, file := range entry.Files {
+		if journals[i] = readUnchanged(file); journals[i] == nil {
+			return nil
+		}
+	}
+
+	ledger, err := reader.decodeLedger(journals)
+	if err != nil {
+		return nil
+	}
+	return ledger
+}
+
+// The journal from its cache entry, nil when the file or the entry changed since the ledger was written
+func readUnchanged(read cachedFile) *AST.Journal {
+	cached, reader := readCache(read.Path)
+	if cached == nil || cached.Size != read.Size || !bytes.Equal(cached.Hash, read.Hash) {
+		return nil
+	}
+
+	file, err := os.Open(read.Path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	content, _, hash, err := readHashed(file, read.Size, 0)
+	if err != nil || int64(len(content)) != read.Size || !bytes.Equal(hash, read.Hash) {
+		return nil
+	}
+
+	items, err := reader.decodeItems(content)
+	if err != nil {
+		return nil
+	}
+	journal := &AST.Journal{File: read.Path, Items: items}
+	if textSize(journal) != read.Size {
+		return nil
+	}
+	return journal
+}
+
+/**
+ * The rest of file, read into the string it ends up in rather than copied
+ * there. The hashes of its first prefix bytes and of all of it are worked
+ * out on the way, size is how long it is expected to be.
+ */
+func readHashed(file io.Reader, size, prefix int64) (string, []byte, []byte, error) {
+	var content strings.Builder
+	content.Grow(int(size))
+
+	hasher := sha256.New()
+	reading := io.TeeReader(file, hasher)
+	if _, err := io.CopyN(&content, reading, prefix); err != nil {
+		return "", nil, nil, err
+	}
+	prefixHash := hasher.Sum(nil)
+	if _, err := io.Copy(&content, reading); err != nil {
+		return "", nil, nil, err
+	}
+	return content.String(), prefixHash, hasher.Sum(nil), nil
+}
+
+// Skipped like writeCache when a journal changed while it was read
+func writeLedger(filename, settings string, loader *journalLoader, ledger *loadedLedger) {
+	for i, journal := range ledger.journals {
+		if textSize(journal) != loader.files[i].Size {
+			return
+		}
+	}
+
+	path, err := ledgerFile(filename)
+	if err != nil {
+		return
+	}
+
+	replaceFile(path, encodeLedger(&ledgerEntry{
+		Path:     filename,
+		Settings: settings,
+		Files:    loader.files,
+		Includes: loader.includes,
+	}, ledger))
+}
+
+// Written next to the old file and moved over it, a reader never sees half of it
+func replaceFile(path string, parts [][]byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+
+	temporary, err := os.CreateTemp(filepath.Dir(path), "journal-*.tmp")
+	if err != nil {
+		return
+	}
+	defer os.Remove(temporary.Name())
+
+	for _, part := range parts {
+		if _, err := temporary.Write(part); err != nil {
+			temporary.Close()
+			return
+		}
+	}
+	if err := temporary.Close(); err != nil {
+		return
+	}
+	os.Rename(temporary.Name(), path)
+}
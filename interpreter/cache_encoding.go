@@ -0,0 +1,814 @@
+package Interpreter
+
+import (
+	"encoding/binary"
+	"fmt"
+	AST "gledger/ast"
+	"gledger/decimal"
+	"time"
+)
+
+/**
+ * The cache is written by hand rather than with encoding/gob, which spends
+ * most of a load on reflection. Every string is stored once in a table and
+ * referred to by its index, so the accounts and commodities repeated in
+ * every transaction are read once. The text of the items is not stored,
+ * only its length: it is cut out of the file, which is read anyway.
+ *
+ * Nil and empty slices and maps are told apart by storing their length
+ * plus one, zero being nil. Pointers are a bool followed by the value.
+ */
+
+const (
+	cacheMagic  = "gledger cache\n"
+	ledgerMagic = "gledger ledger\n"
+)
+
+type cacheWriter struct {
+	body    []byte
+	indices map[string]uint64
+	table   []string
+}
+
+// Encoded journals take about as much room as their text, size is that of the text
+func newCacheWriter(size int64) *cacheWriter {
+	return &cacheWriter{body: make([]byte, 0, size+size/2), indices: map[string]uint64{}}
+}
+
+func encodeCache(entry *cacheEntry) [][]byte {
+	writer := newCacheWriter(entry.Size)
+	writer.items(entry.Items)
+
+	header := &cacheWriter{body: []byte(cacheMagic)}
+	header.uint(cacheVersion)
+	header.raw(entry.Path)
+	header.int(entry.Size)
+	header.raw(string(entry.Hash))
+	header.raw(entry.Settings)
+	return writer.after(header)
+}
+
+/**
+ * The items stay in the entries of the journals, the ledger only says where
+ * the transactions are and keeps what loading changed or worked out.
+ */
+func encodeLedger(entry *ledgerEntry, ledger *loadedLedger) [][]byte {
+	writer := newCacheWriter(0)
+	writer.uint(uint64(len(ledger.order)))
+	for _, ref := range ledger.order {
+		writer.uint(uint64(ref.journal))
+		writer.uint(uint64(ref.item))
+	}
+
+	// The postings of transactions that got automated postings or balance assignments
+	var changed []int
+	for i, transaction := range ledger.loaded {
+		if transaction.HasBalanceAssignments() || hasGenerated(transaction) {
+			changed = append(changed, i)
+		}
+	}
+	writer.uint(uint64(len(changed)))
+	for _, position := range changed {
+		postings := ledger.loaded[position].Postings
+		writer.uint(uint64(position))
+		writer.uint(uint64(len(postings)))
+		for i := range postings {
+			writer.posting(&postings[i])
+		}
+	}
+
+	// The date index, as positions in the order the transactions were read
+	positions := make(map[*AST.Transaction]int, len(ledger.loaded))
+	for i, transaction := range ledger.loaded {
+		positions[transaction] = i
+	}
+	writer.uint(uint64(len(ledger.transactions)))
+	for _, transaction := range ledger.transactions {
+		writer.uint(uint64(positions[transaction]))
+	}
+
+	writer.uint(uint64(len(ledger.accounts)))
+	for account, accountType := range ledger.accounts {
+		writer.string(account)
+		writer.int(int64(accountType))
+	}
+
+	writer.uint(uint64(len(ledger.prices)))
+	for commodity, prices := range ledger.prices {
+		writer.string(commodity)
+		writer.uint(uint64(len(prices)))
+		for i := range prices {
+			writer.price(&prices[i])
+		}
+	}
+
+	writer.uint(uint64(len(ledger.holdings.Lots)))
+	for account, lots := range ledger.holdings.Lots {
+		writer.string(account)
+		writer.uint(uint64(len(lots)))
+		for _, lot := range lots {
+			writer.string(lot.Account)
+			writer.amount(&lot.Quantity)
+			writer.amount(&lot.Cost)
+			writer.time(lot.Date)
+		}
+	}
+
+	writer.uint(uint64(len(ledger.holdings.Gains)))
+	for i := range ledger.holdings.Gains {
+		gain := &ledger.holdings.Gains[i]
+		writer.time(gain.Date)
+		writer.string(gain.Account)
+		writer.amount(&gain.Quantity)
+		writer.time(gain.Acquired)
+		writer.amount(&gain.Cost)
+		writer.amount(&gain.Proceeds)
+		writer.amount(&gain.Gain)
+	}
+
+	header := &cacheWriter{body: []byte(ledgerMagic)}
+	header.uint(cacheVersion)
+	header.raw(entry.Path)
+	header.raw(entry.Settings)
+	header.uint(uint64(len(entry.Files)))
+	for _, file := range entry.Files {
+		header.raw(file.Path)
+		header.int(file.Size)
+		header.raw(string(file.Hash))
+	}
+	header.uint(uint64(len(entry.Includes)))
+	for _, include := range entry.Includes {
+		header.raw(include.Pattern)
+		header.uint(uint64(len(include.Matches)))
+		for _, match := range include.Matches {
+			header.raw(match)
+		}
+	}
+	return writer.after(header)
+}
+
+/**
+ * The header goes first, then the string table and the body. Reading the
+ * header needs nothing else. The parts are written one after the other,
+ * the body is too big to be copied behind the header for nothing.
+ */
+func (writer *cacheWriter) after(header *cacheWriter) [][]byte {
+	header.uint(uint64(len(writer.table)))
+	for _, value := range writer.table {
+		header.raw(value)
+	}
+	return [][]byte{header.body, writer.body}
+}
+
+func (writer *cacheWriter) uint(value uint64) {
+	writer.body = binary.AppendUvarint(writer.body, value)
+}
+
+func (writer *cacheWriter) int(value int64) {
+	writer.body = binary.AppendVarint(writer.body, value)
+}
+
+func (writer *cacheWriter) bool(value bool) {
+	if value {
+		writer.body = append(writer.body, 1)
+	} else {
+		writer.body = append(writer.body, 0)
+	}
+}
+
+func (writer *cacheWriter) raw(value string) {
+	writer.uint(uint64(len(value)))
+	writer.body = append(writer.body, value...)
+}
+
+func (writer *cacheWriter) string(value string) {
+	index, exists := writer.indices[value]
+	if !exists {
+		index = uint64(len(writer.table))
+		writer.indices[value] = index
+		writer.table = append(writer.table, value)
+	}
+	writer.uint(index)
+}
+
+// Zero stays zero, the other dates are all in UTC
+func (writer *cacheWriter) time(value time.Time) {
+	writer.bool(value.IsZero())
+	if !value.IsZero() {
+		writer.int(value.Unix())
+	}
+}
+
+func (writer *cacheWriter) length(length int, isNil bool) {
+	if isNil {
+		writer.uint(0)
+	} else {
+		writer.uint(uint64(length) + 1)
+	}
+}
+
+func (writer *cacheWriter) strings(values []string) {
+	writer.length(len(values), values == nil)
+	for _, value := range values {
+		writer.string(value)
+	}
+}
+
+func (writer *cacheWriter) tags(tags map[string]string) {
+	writer.length(len(tags), tags == nil)
+	for name, value := range tags {
+		writer.string(name)
+		writer.string(value)
+	}
+}
+
+func (writer *cacheWriter) amount(amount *AST.Amount) {
+	writer.int(amount.Value.Coefficient())
+	writer.int(int64(amount.Value.Scale()))
+	writer.string(amount.Commodity)
+	writer.string(amount.Style.Symbol)
+	writer.bool(amount.Style.Prefix)
+	writer.bool(amount.Style.Spaced)
+	writer.bool(amount.Style.Grouped)
+}
+
+func (writer *cacheWriter) optionalAmount(amount *AST.Amount) {
+	writer.bool(amount != nil)
+	if amount != nil {
+		writer.amount(amount)
+	}
+}
+
+func (writer *cacheWriter) price(price *AST.MarketPrice) {
+	writer.time(price.Date)
+	writer.string(price.Commodity)
+	writer.amount(&price.Price)
+}
+
+func (writer *cacheWriter) position(position AST.Position) {
+	writer.string(position.File)
+	writer.int(int64(position.Line))
+	writer.int(int64(position.Column))
+}
+
+func (writer *cacheWriter) posting(posting *AST.Posting) {
+	writer.position(posting.Position)
+	writer.int(int64(posting.Status))
+	writer.int(int64(posting.Kind))
+	writer.string(posting.Account)
+	writer.amount(&posting.Amount)
+	writer.bool(posting.Elided)
+	writer.strings(posting.Comments)
+	writer.tags(posting.Tags)
+	writer.optionalAmount(posting.Assertion)
+	writer.bool(posting.Assigned)
+	writer.optionalAmount(posting.Price)
+	writer.bool(posting.TotalPrice)
+	writer.bool(posting.Lot != nil)
+	if posting.Lot != nil {
+		writer.amount(&posting.Lot.Cost)
+		writer.time(posting.Lot.Date)
+	}
+	writer.bool(posting.Generated)
+	writer.time(posting.Date)
+}
+
+func (writer *cacheWriter) transaction(transaction *AST.Transaction) {
+	writer.bool(transaction != nil)
+	if transaction == nil {
+		return
+	}
+	writer.position(transaction.Position)
+	writer.time(transaction.Date)
+	writer.time(transaction.EffectiveDate)
+	writer.int(int64(transaction.Status))
+	writer.string(transaction.Description)
+	writer.length(len(transaction.Postings), transaction.Postings == nil)
+	for i := range transaction.Postings {
+		writer.posting(&transaction.Postings[i])
+	}
+	writer.strings(transaction.Comments)
+	writer.tags(transaction.Tags)
+}
+
+func (writer *cacheWriter) item(item *AST.Item) {
+	writer.int(int64(item.Kind))
+	writer.uint(uint64(len(item.Text)))
+	writer.int(int64(item.Line))
+	writer.transaction(item.Transaction)
+
+	writer.bool(item.Directive != nil)
+	if directive := item.Directive; directive != nil {
+		writer.string(directive.Name)
+		writer.string(directive.Argument)
+		writer.bool(directive.Price != nil)
+		if directive.Price != nil {
+			writer.price(directive.Price)
+		}
+	}
+
+	writer.bool(item.Periodic != nil)
+	if periodic := item.Periodic; periodic != nil {
+		writer.string(periodic.Period.Expression)
+		writer.int(int64(periodic.Period.Unit))
+		writer.int(int64(periodic.Period.Count))
+		writer.time(periodic.Period.Start)
+		writer.time(periodic.Period.End)
+		writer.transaction(periodic.Transaction)
+	}
+
+	writer.bool(item.Automated != nil)
+	if automated := item.Automated; automated != nil {
+		writer.string(automated.Query)
+		writer.transaction(automated.Transaction)
+	}
+}
+
+// How many transactions and postings there are goes first, reading them allocates once
+func (writer *cacheWriter) items(items []*AST.Item) {
+	transactions, postings := 0, 0
+	for _, item := range items {
+		for _, transaction := range []*AST.Transaction{item.Transaction, periodicTransaction(item), automatedTransaction(item)} {
+			if transaction != nil {
+				transactions++
+				postings += len(transaction.Postings)
+			}
+		}
+	}
+
+	writer.uint(uint64(len(items)))
+	writer.uint(uint64(transactions))
+	writer.uint(uint64(postings))
+	for _, item := range items {
+		writer.item(item)
+	}
+}
+
+func hasGenerated(transaction *AST.Transaction) bool {
+	for i := range transaction.Postings {
+		if transaction.Postings[i].Generated {
+			return true
+		}
+	}
+	return false
+}
+
+func periodicTransaction(item *AST.Item) *AST.Transaction {
+	if item.Periodic == nil {
+		return nil
+	}
+	return item.Periodic.Transaction
+}
+
+func automatedTransaction(item *AST.Item) *AST.Transaction {
+	if item.Automated == nil {
+		return nil
+	}
+	return item.Automated.Transaction
+}
+
+/**
+ * cacheReader goes through an encoded entry. The first thing that does not
+ * make sense is kept in err and everything read after it is zero, so the
+ * caller checks once at the end.
+ */
+type cacheReader struct {
+	data  []byte
+	table []string
+	err   error
+
+	// Items, transactions and postings are handed out from blocks allocated for all of them
+	items        []AST.Item
+	transactions []AST.Transaction
+	postings     []AST.Posting
+}
+
+// The header of an entry, the items are read by decodeItems when it is of any use
+func decodeCache(data []byte) (*cacheEntry, *cacheReader, error) {
+	if len(data) < len(cacheMagic) || string(data[:len(cacheMagic)]) != cacheMagic {
+		return nil, nil, fmt.Errorf("not a cache file")
+	}
+
+	reader := &cacheReader{data: data[len(cacheMagic):]}
+	entry := &cacheEntry{Version: int(reader.uint())}
+	if entry.Version != cacheVersion {
+		return nil, nil, fmt.Errorf("cache version %d instead of %d", entry.Version, cacheVersion)
+	}
+	entry.Path = reader.raw()
+	entry.Size = reader.int()
+	entry.Hash = []byte(reader.raw())
+	entry.Settings = reader.raw()
+	return entry, reader, reader.err
+}
+
+/**
+ * The items of the entry, their text cut out of content in order. The
+ * content has to start with what the entry was made from.
+ */
+func (reader *cacheReader) decodeItems(content string) ([]*AST.Item, error) {
+	reader.readTable()
+
+	items := make([]*AST.Item, reader.count())
+	reader.items = make([]AST.Item, len(items))
+	reader.transactions = make([]AST.Transaction, reader.count())
+	reader.postings = make([]AST.Posting, reader.count())
+	offset := 0
+	for i := range items {
+		var length int
+		items[i], length = reader.item()
+		if reader.err != nil {
+			break
+		}
+		if offset+length > len(content) {
+			return nil, fmt.Errorf("cached items are longer than the file")
+		}
+		items[i].Text = content[offset : offset+length]
+		offset += length
+	}
+	if reader.err != nil {
+		return nil, reader.err
+	}
+	return items, nil
+}
+
+// The header of a ledger entry, the rest is read by decodeLedger once the files were checked
+func decodeLedgerEntry(data []byte) (*ledgerEntry, *cacheReader, error) {
+	if len(data) < len(ledgerMagic) || string(data[:len(ledgerMagic)]) != ledgerMagic {
+		return nil, nil, fmt.Errorf("not a ledger cache file")
+	}
+
+	reader := &cacheReader{data: data[len(ledgerMagic):]}
+	entry := &ledgerEntry{Version: int(reader.uint())}
+	if entry.Version != cacheVersion {
+		return nil, nil, fmt.Errorf("cache version %d instead of %d", entry.Version, cacheVersion)
+	}
+	entry.Path = reader.raw()
+	entry.Settings = reader.raw()
+
+	entry.Files = make([]cachedFile, reader.count())
+	for i := range entry.Files {
+		entry.Files[i] = cachedFile{Path: reader.raw(), Size: reader.int(), Hash: []byte(reader.raw())}
+	}
+
+	entry.Includes = make([]includeMatch, reader.count())
+	for i := range entry.Includes {
+		entry.Includes[i].Pattern = reader.raw()
+		entry.Includes[i].Matches = make([]string, reader.count())
+		for j := range entry.Includes[i].Matches {
+			entry.Includes[i].Matches[j] = reader.raw()
+		}
+	}
+	return entry, reader, reader.err
+}
+
+// What loading worked out from the journals, which were read from their own entries
+func (reader *cacheReader) decodeLedger(journals []*AST.Journal) (*loadedLedger, error) {
+	reader.readTable()
+
+	ledger := &loadedLedger{
+		journals: journals,
+		accounts: map[string]AST.AccountType{},
+		prices:   PriceHistory{},
+		holdings: &Holdings{Lots: map[string][]*Lot{}},
+	}
+
+	ledger.order = make([]itemRef, reader.count())
+	for i := range ledger.order {
+		ref := itemRef{journal: int(reader.uint()), item: int(reader.uint())}
+		if ref.journal >= len(ledger.journals) || ref.item >= len(ledger.journals[ref.journal].Items) {
+			reader.fail("invalid item %d of journal %d in cache", ref.item, ref.journal)
+			break
+		}
+		ledger.order[i] = ref
+
+		// The file is set like when the journal is loaded, the parser leaves it out
+		item := ledger.journals[ref.journal].Items[ref.item]
+		file := ledger.journals[ref.journal].File
+		switch {
+		case item.Kind == AST.ITEM_TRANSACTION && item.Transaction != nil:
+			setFile(item.Transaction, file)
+			ledger.loaded = append(ledger.loaded, item.Transaction)
+		case item.Kind == AST.ITEM_PERIODIC && item.Periodic != nil:
+			setFile(item.Periodic.Transaction, file)
+			ledger.periodic = append(ledger.periodic, item.Periodic)
+		case item.Kind == AST.ITEM_AUTOMATED && item.Automated != nil:
+			setFile(item.Automated.Transaction, file)
+			ledger.automated = append(ledger.automated, item.Automated)
+		default:
+			reader.fail("item %d of journal %d in cache is not a transaction", ref.item, ref.journal)
+		}
+	}
+
+	for count := reader.count(); count > 0; count-- {
+		position := reader.uint()
+		if position >= uint64(len(ledger.loaded)) {
+			reader.fail("invalid transaction %d in cache", position)
+			break
+		}
+		postings := make([]AST.Posting, reader.count())
+		for i := range postings {
+			reader.posting(&postings[i])
+		}
+		ledger.loaded[position].Postings = postings
+	}
+
+	ledger.transactions = make([]*AST.Transaction, reader.count())
+	for i := range ledger.transactions {
+		position := reader.uint()
+		if position >= uint64(len(ledger.loaded)) {
+			reader.fail("invalid transaction %d in cache", position)
+			break
+		}
+		ledger.transactions[i] = ledger.loaded[position]
+	}
+
+	for count := reader.count(); count > 0; count-- {
+		account := reader.string()
+		ledger.accounts[account] = AST.AccountType(reader.int())
+	}
+
+	for count := reader.count(); count > 0; count-- {
+		commodity := reader.string()
+		prices := make([]AST.MarketPrice, reader.count())
+		for i := range prices {
+			prices[i] = reader.price()
+		}
+		ledger.prices[commodity] = prices
+	}
+
+	for count := reader.count(); count > 0; count-- {
+		account := reader.string()
+		lots := make([]*Lot, reader.count())
+		for i := range lots {
+			lots[i] = &Lot{Account: reader.string(), Quantity: reader.amount(), Cost: reader.amount(), Date: reader.time()}
+		}
+		ledger.holdings.Lots[account] = lots
+	}
+
+	if count := reader.count(); count > 0 {
+		ledger.holdings.Gains = make([]RealizedGain, count)
+		for i := range ledger.holdings.Gains {
+			ledger.holdings.Gains[i] = RealizedGain{
+				Date:     reader.time(),
+				Account:  reader.string(),
+				Quantity: reader.amount(),
+				Acquired: reader.time(),
+				Cost:     reader.amount(),
+				Proceeds: reader.amount(),
+				Gain:     reader.amount(),
+			}
+		}
+	}
+
+	if reader.err != nil {
+		return nil, reader.err
+	}
+	return ledger, nil
+}
+
+func (reader *cacheReader) readTable() {
+	reader.table = make([]string, reader.count())
+	for i := range reader.table {
+		reader.table[i] = reader.raw()
+	}
+}
+
+func (reader *cacheReader) fail(format string, args ...any) {
+	if reader.err == nil {
+		reader.err = fmt.Errorf(format, args...)
+	}
+	reader.data = nil
+}
+
+func (reader *cacheReader) uint() uint64 {
+	value, read := binary.Uvarint(reader.data)
+	if read <= 0 {
+		reader.fail("truncated cache")
+		return 0
+	}
+	reader.data = reader.data[read:]
+	return value
+}
+
+func (reader *cacheReader) int() int64 {
+	value, read := binary.Varint(reader.data)
+	if read <= 0 {
+		reader.fail("truncated cache")
+		return 0
+	}
+	reader.data = reader.data[read:]
+	return value
+}
+
+func (reader *cacheReader) bool() bool {
+	if len(reader.data) == 0 {
+		reader.fail("truncated cache")
+		return false
+	}
+	value := reader.data[0] == 1
+	reader.data = reader.data[1:]
+	return value
+}
+
+// A length that has to fit in what is left, every element takes at least a byte
+func (reader *cacheReader) count() int {
+	count := reader.uint()
+	if count > uint64(len(reader.data)) {
+		reader.fail("invalid length %d in cache", count)
+		return 0
+	}
+	return int(count)
+}
+
+func (reader *cacheReader) raw() string {
+	length := reader.count()
+	value := string(reader.data[:length])
+	reader.data = reader.data[length:]
+	return value
+}
+
+func (reader *cacheReader) string() string {
+	index := reader.uint()
+	if index >= uint64(len(reader.table)) {
+		reader.fail("invalid string %d in cache", index)
+		return ""
+	}
+	return reader.table[index]
+}
+
+func (reader *cacheReader) time() time.Time {
+	if reader.bool() {
+		return time.Time{}
+	}
+	return time.Unix(reader.int(), 0).UTC()
+}
+
+// The length of a slice or map and whether it is nil
+func (reader *cacheReader) length() (int, bool) {
+	length := reader.uint()
+	if length == 0 {
+		return 0, true
+	}
+	if length-1 > uint64(len(reader.data)) {
+		reader.fail("invalid length %d in cache", length-1)
+		return 0, true
+	}
+	return int(length - 1), false
+}
+
+func (reader *cacheReader) strings() []string {
+	length, isNil := reader.length()
+	if isNil {
+		return nil
+	}
+	values := make([]string, length)
+	for i := range values {
+		values[i] = reader.string()
+	}
+	return values
+}
+
+func (reader *cacheReader) tags() map[string]string {
+	length, isNil := reader.length()
+	if isNil {
+		return nil
+	}
+	tags := make(map[string]string, length)
+	for i := 0; i < length; i++ {
+		name := reader.string()
+		tags[name] = reader.string()
+	}
+	return tags
+}
+
+func (reader *cacheReader) amount() AST.Amount {
+	coefficient := reader.int()
+	scale := reader.int()
+	return AST.Amount{
+		Value:     decimal.New(coefficient, int32(scale)),
+		Commodity: reader.string(),
+		Style: AST.AmountStyle{
+			Symbol:  reader.string(),
+			Prefix:  reader.bool(),
+			Spaced:  reader.bool(),
+			Grouped: reader.bool(),
+		},
+	}
+}
+
+func (reader *cacheReader) optionalAmount() *AST.Amount {
+	if !reader.bool() {
+		return nil
+	}
+	amount := reader.amount()
+	return &amount
+}
+
+func (reader *cacheReader) price() AST.MarketPrice {
+	return AST.MarketPrice{Date: reader.time(), Commodity: reader.string(), Price: reader.amount()}
+}
+
+func (reader *cacheReader) position() AST.Position {
+	return AST.Position{
+		File:   reader.string(),
+		Line:   int(reader.int()),
+		Column: int(reader.int()),
+	}
+}
+
+func (reader *cacheReader) posting(posting *AST.Posting) {
+	posting.Position = reader.position()
+	posting.Status = AST.Status(reader.int())
+	posting.Kind = AST.PostingKind(reader.int())
+	posting.Account = reader.string()
+	posting.Amount = reader.amount()
+	posting.Elided = reader.bool()
+	posting.Comments = reader.strings()
+	posting.Tags = reader.tags()
+	posting.Assertion = reader.optionalAmount()
+	posting.Assigned = reader.bool()
+	posting.Price = reader.optionalAmount()
+	posting.TotalPrice = reader.bool()
+	if reader.bool() {
+		posting.Lot = &AST.Lot{Cost: reader.amount(), Date: reader.time()}
+	}
+	posting.Generated = reader.bool()
+	posting.Date = reader.time()
+}
+
+func (reader *cacheReader) transaction() *AST.Transaction {
+	if !reader.bool() {
+		return nil
+	}
+
+	if len(reader.transactions) == 0 {
+		reader.transactions = make([]AST.Transaction, 1024)
+	}
+	transaction := &reader.transactions[0]
+	reader.transactions = reader.transactions[1:]
+
+	transaction.Position = reader.position()
+	transaction.Date = reader.time()
+	transaction.EffectiveDate = reader.time()
+	transaction.Status = AST.Status(reader.int())
+	transaction.Description = reader.string()
+	if length, isNil := reader.length(); !isNil {
+		if len(reader.postings) < length {
+			reader.postings = make([]AST.Posting, max(length, 4096))
+		}
+		// Capped, postings appended later by automated transactions do not run into the next transaction
+		transaction.Postings = reader.postings[:length:length]
+		reader.postings = reader.postings[length:]
+		for i := range transaction.Postings {
+			reader.posting(&transaction.Postings[i])
+		}
+	}
+	transaction.Comments = reader.strings()
+	transaction.Tags = reader.tags()
+	return transaction
+}
+
+// The item without its text, and how long the text is
+func (reader *cacheReader) item() (*AST.Item, int) {
+	if len(reader.items) == 0 {
+		reader.items = make([]AST.Item, 1024)
+	}
+	item := &reader.items[0]
+	reader.items = reader.items[1:]
+
+	item.Kind = AST.ItemKind(reader.int())
+	length := int(reader.uint())
+	item.Line = int(reader.int())
+	item.Transaction = reader.transaction()
+
+	if reader.bool() {
+		item.Directive = &AST.Directive{Name: reader.string(), Argument: reader.string()}
+		if reader.bool() {
+			price := reader.price()
+			item.Directive.Price = &price
+		}
+	}
+
+	if reader.bool() {
+		period := AST.Period{
+			Expression: reader.string(),
+			Unit:       AST.PeriodUnit(reader.int()),
+			Count:      int(reader.int()),
+			Start:      reader.time(),
+			End:        reader.time(),
+		}
+		item.Periodic = &AST.PeriodicTransaction{Period: period, Transaction: reader.transaction()}
+	}
+
+	if reader.bool() {
+		query := reader.string()
+		automated, err := AST.NewAutomatedTransaction(query, reader.transaction())
+		if err != nil {
+			reader.fail("%v", err)
+			return item, 0
+		}
+		item.Automated = automated
+	}
+
+	return item, length
+}
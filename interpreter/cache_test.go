@@ -0,0 +1,422 @@
+package Interpreter
+
+import (
+	"bytes"
+	"fmt"
+	AST "gledger/ast"
+	"gledger/config"
+	"gledger/decimal"
+	Parser "gledger/parser"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const cachedJournal = `; the main journal
+account assets:checking
+P 2024-01-01 VTI $200.00
+include sub/*.journal
+
+= expenses:dining
+    (budget:dining)        -1.0
+
+~ monthly from 2025-01  Rent
+    expenses:rent          $1,500.00
+    assets:checking
+
+2023-01-10 Buy
+    assets:broker          10 VTI {$200.00}
+    assets:checking
+
+2024-04-01 * Sell  ; fifo
+    ; :broker:
+    assets:broker          -5 VTI @ $250.00
+    assets:checking        $1250.00
+    income:gains
+
+2025-01-05 Dinner
+    expenses:dining:out    $45.32  ; receipt: 12
+    assets:checking
+
+2025-02-01 Cash
+    assets:cash            = $200.00
+    assets:checking
+`
+
+const includedJournal = `2025-01-31 Salary
+    assets:checking        $3,000.00 = $2,204.68
+    income:salary
+
+2025-03-01 ! Coffee
+    expenses:food          $3.50
+    liabilities:credit card
+`
+
+// The items of a journal come back from its cache entry as they were parsed
+func TestCacheRoundTrip(t *testing.T) {
+	journal, err := Parser.ParseJournal(cachedJournal+includedJournal, Parser.Options{})
+	if err != nil {
+		t.Fatalf("journal did not parse: %v", err)
+	}
+
+	entry := &cacheEntry{
+		Path:     "/journal",
+		Size:     textSize(journal),
+		Hash:     []byte("hash"),
+		Settings: "settings",
+		Items:    journal.Items,
+	}
+	decoded, reader, err := decodeCache(bytes.Join(encodeCache(entry), nil))
+	if err != nil {
+		t.Fatalf("header did not decode: %v", err)
+	}
+	if decoded.Path != entry.Path || decoded.Size != entry.Size || !bytes.Equal(decoded.Hash, entry.Hash) || decoded.Settings != entry.Settings {
+		t.Errorf("header decoded as %+v", decoded)
+	}
+
+	items, err := reader.decodeItems(cachedJournal + includedJournal)
+	if err != nil {
+		t.Fatalf("items did not decode: %v", err)
+	}
+	if len(items) != len(journal.Items) {
+		t.Fatalf("got %d items, want %d", len(items), len(journal.Items))
+	}
+	for i, item := range items {
+		if !reflect.DeepEqual(item, journal.Items[i]) {
+			t.Errorf("item %d decoded as %+v, want %+v", i, item, journal.Items[i])
+		}
+	}
+
+	// Content shorter than what was cached is not cut into
+	_, reader, _ = decodeCache(bytes.Join(encodeCache(entry), nil))
+	if _, err := reader.decodeItems(cachedJournal); err == nil {
+		t.Errorf("items decoded from a shorter file")
+	}
+}
+
+/**
+ * Every field of everything the cache stores is set, so a field added to
+ * the AST and left out of the encoding fails here instead of being dropped
+ * from cached journals.
+ */
+func TestCacheEncodesEveryField(t *testing.T) {
+	filler := &fieldFiller{t: t}
+	item := &AST.Item{}
+	filler.fill(reflect.ValueOf(item).Elem())
+
+	entry := &cacheEntry{Path: "/journal", Size: int64(len(item.Text)), Items: []*AST.Item{item}}
+	_, reader, err := decodeCache(bytes.Join(encodeCache(entry), nil))
+	if err != nil {
+		t.Fatalf("header did not decode: %v", err)
+	}
+	items, err := reader.decodeItems(item.Text)
+	if err != nil {
+		t.Fatalf("items did not decode: %v", err)
+	}
+	if difference := firstDifference(reflect.ValueOf(items[0]), reflect.ValueOf(item), "Item"); difference != "" {
+		t.Errorf("the cache changes %s", difference)
+	}
+
+	// What the ledger entry keeps beside the items
+	ledger := &loadedLedger{accounts: map[string]AST.AccountType{}, prices: PriceHistory{}, holdings: &Holdings{}}
+	filler.fill(reflect.ValueOf(&ledger.accounts).Elem())
+	filler.fill(reflect.ValueOf(&ledger.prices).Elem())
+	filler.fill(reflect.ValueOf(ledger.holdings).Elem())
+
+	ledgerEntry, reader, err := decodeLedgerEntry(bytes.Join(encodeLedger(&ledgerEntry{Path: "/journal"}, ledger), nil))
+	if err != nil {
+		t.Fatalf("ledger header did not decode: %v", err)
+	}
+	decoded, err := reader.decodeLedger(nil)
+	if err != nil {
+		t.Fatalf("ledger of %s did not decode: %v", ledgerEntry.Path, err)
+	}
+	for _, field := range []struct {
+		name      string
+		got, want any
+	}{
+		{"accounts", decoded.accounts, ledger.accounts},
+		{"prices", decoded.prices, ledger.prices},
+		{"holdings", decoded.holdings, ledger.holdings},
+	} {
+		if difference := firstDifference(reflect.ValueOf(field.got), reflect.ValueOf(field.want), field.name); difference != "" {
+			t.Errorf("the ledger entry changes %s", difference)
+		}
+	}
+}
+
+// Fields the cache does not store, with what stands in for them
+var uncachedFields = map[string]string{
+	"AutomatedTransaction.pattern": "compiled again from the query",
+}
+
+// fieldFiller gives every field a value of its own, none of them zero
+type fieldFiller struct {
+	t    *testing.T
+	next int64
+}
+
+func (filler *fieldFiller) fill(value reflect.Value) {
+	filler.next++
+	switch value.Type() {
+	case reflect.TypeOf(time.Time{}):
+		// Dates are stored to the second, in UTC like the parser makes them
+		value.Set(reflect.ValueOf(time.Unix(filler.next*86400, 0).UTC()))
+		return
+	case reflect.TypeOf(decimal.Decimal{}):
+		value.Set(reflect.ValueOf(decimal.New(filler.next, 2)))
+		return
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(fmt.Sprintf("value %d", filler.next))
+	case reflect.Bool:
+		value.SetBool(true)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		value.SetInt(filler.next)
+	case reflect.Pointer:
+		value.Set(reflect.New(value.Type().Elem()))
+		filler.fill(value.Elem())
+	case reflect.Slice:
+		value.Set(reflect.MakeSlice(value.Type(), 1, 1))
+		filler.fill(value.Index(0))
+	case reflect.Map:
+		key, element := reflect.New(value.Type().Key()).Elem(), reflect.New(value.Type().Elem()).Elem()
+		filler.fill(key)
+		filler.fill(element)
+		value.Set(reflect.MakeMap(value.Type()))
+		value.SetMapIndex(key, element)
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			name := value.Type().Name() + "." + field.Name
+			if _, skipped := uncachedFields[name]; skipped {
+				continue
+			}
+			if !field.IsExported() {
+				filler.t.Fatalf("%s is not exported, the cache cannot store it: add it to uncachedFields with what stands in for it", name)
+			}
+			filler.fill(value.Field(i))
+		}
+	default:
+		filler.t.Fatalf("the cache test cannot fill a %s", value.Type())
+	}
+}
+
+// Where got and want first differ, empty when they are equal
+func firstDifference(got, want reflect.Value, path string) string {
+	if reflect.DeepEqual(got.Interface(), want.Interface()) {
+		return ""
+	}
+
+	switch want.Kind() {
+	case reflect.Pointer:
+		if !got.IsNil() && !want.IsNil() {
+			return firstDifference(got.Elem(), want.Elem(), path)
+		}
+	case reflect.Slice:
+		if got.Len() == want.Len() {
+			for i := 0; i < want.Len(); i++ {
+				if difference := firstDifference(got.Index(i), want.Index(i), fmt.Sprintf("%s[%d]", path, i)); difference != "" {
+					return difference
+				}
+			}
+		}
+	case reflect.Map:
+		if got.Len() == want.Len() {
+			for _, key := range want.MapKeys() {
+				if element := got.MapIndex(key); element.IsValid() {
+					if difference := firstDifference(element, want.MapIndex(key), fmt.Sprintf("%s[%v]", path, key)); difference != "" {
+						return difference
+					}
+				}
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < want.NumField(); i++ {
+			if !want.Type().Field(i).IsExported() {
+				continue
+			}
+			if difference := firstDifference(got.Field(i), want.Field(i), path+"."+want.Type().Field(i).Name); difference != "" {
+				return difference
+			}
+		}
+	}
+	return fmt.Sprintf("%s: got %+v, want %+v", path, got.Interface(), want.Interface())
+}
+
+// A load from the ledger entry gives what loading the journals worked out
+func TestLedgerCache(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	directory := t.TempDir()
+	filename := filepath.Join(directory, "main.journal")
+	writeJournal(t, filename, cachedJournal)
+	writeJournal(t, filepath.Join(directory, "sub", "2025.journal"), includedJournal)
+
+	parsed := loadJournal(t, filename)
+	if cachedLedger(t, parsed, filename) == nil {
+		t.Fatalf("loading did not leave a ledger entry")
+	}
+	cached := loadJournal(t, filename)
+	compareLedgers(t, cached, parsed)
+
+	// Something appended to an included journal is parsed, the rest comes from its entry
+	file, err := os.OpenFile(filepath.Join(directory, "sub", "2025.journal"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("\n2025-03-02 Lunch\n    expenses:dining    $12.00\n    assets:checking\n")
+	file.Close()
+
+	if cachedLedger(t, parsed, filename) != nil {
+		t.Errorf("the ledger entry was used after a journal grew")
+	}
+	appended := loadJournal(t, filename)
+	if len(appended.transactions) != len(parsed.transactions)+1 {
+		t.Fatalf("got %d transactions after the append, want %d", len(appended.transactions), len(parsed.transactions)+1)
+	}
+	if last := appended.transactions[len(appended.transactions)-1]; last.Description != "Lunch" || len(last.Postings) != 3 {
+		t.Errorf("the appended transaction was read as %+v", last)
+	}
+	compareLedgers(t, loadJournal(t, filename), appended)
+
+	// A new file matching an include is read
+	writeJournal(t, filepath.Join(directory, "sub", "2026.journal"), "2026-01-01 New year\n    expenses:food    $1.00\n    assets:checking\n")
+	if cachedLedger(t, parsed, filename) != nil {
+		t.Errorf("the ledger entry was used after a file matching an include was added")
+	}
+	if added := loadJournal(t, filename); len(added.transactions) != len(appended.transactions)+1 {
+		t.Errorf("got %d transactions after a file was added, want %d", len(added.transactions), len(appended.transactions)+1)
+	}
+}
+
+// An edit that keeps the size and the modification time is not served from the cache
+func TestCacheSameSizeEdit(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	directory := t.TempDir()
+	filename := filepath.Join(directory, "main.journal")
+	writeJournal(t, filename, cachedJournal)
+	included := filepath.Join(directory, "sub", "2025.journal")
+	writeJournal(t, included, includedJournal)
+	loadJournal(t, filename)
+
+	info, err := os.Stat(included)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeJournal(t, included, strings.Replace(includedJournal, "$3.50", "$9.50", 1))
+	if err := os.Chtimes(included, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, transaction := range loadJournal(t, filename).transactions {
+		if transaction.Description == "Coffee" && transaction.Postings[0].Amount.String() != "$9.50" {
+			t.Errorf("the edited journal was read as %s", transaction.Postings[0].Amount.String())
+		}
+	}
+
+	// Without the ledger entry the journal comes from its own entry, which is checked the same way
+	path, err := ledgerFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(path)
+	writeJournal(t, included, strings.Replace(includedJournal, "$3.50", "$7.50", 1))
+	if err := os.Chtimes(included, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	for _, transaction := range loadJournal(t, filename).transactions {
+		if transaction.Description == "Coffee" && transaction.Postings[0].Amount.String() != "$7.50" {
+			t.Errorf("the edited journal was read as %s from its cache entry", transaction.Postings[0].Amount.String())
+		}
+	}
+}
+
+func writeJournal(t *testing.T, filename, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func loadJournal(t *testing.T, filename string) *Interpreter {
+	t.Helper()
+	interpreter := NewInterpreter(config.DefaultConfig())
+	if err := interpreter.LoadFromFile(filename); err != nil {
+		t.Fatalf("loading %s failed: %v", filename, err)
+	}
+	return interpreter
+}
+
+// The interpreter with content loaded from a journal of its own, and the error loading gave
+func loadText(t *testing.T, content string) (*Interpreter, error) {
+	t.Helper()
+	return loadTextWith(t, config.DefaultConfig(), content)
+}
+
+func loadTextWith(t *testing.T, settings *config.Config, content string) (*Interpreter, error) {
+	t.Helper()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	filename := filepath.Join(t.TempDir(), "main.journal")
+	writeJournal(t, filename, content)
+
+	interpreter := NewInterpreter(settings)
+	return interpreter, interpreter.LoadFromFile(filename)
+}
+
+// The ledger entry loadLedger would use for filename, nil when it would load the journals
+func cachedLedger(t *testing.T, interpreter *Interpreter, filename string) *loadedLedger {
+	t.Helper()
+	method, err := interpreter.lotMethod()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return readLedger(filename, ledgerSettings(Parser.Options{DateFormat: interpreter.config.DateFormat}, method))
+}
+
+func compareLedgers(t *testing.T, got, want *Interpreter) {
+	t.Helper()
+	if len(got.transactions) != len(want.transactions) {
+		t.Fatalf("got %d transactions, want %d", len(got.transactions), len(want.transactions))
+	}
+	for i, transaction := range got.transactions {
+		if !reflect.DeepEqual(transaction, want.transactions[i]) {
+			t.Errorf("transaction %d is %+v, want %+v", i, transaction, want.transactions[i])
+		}
+	}
+
+	if !reflect.DeepEqual(got.accounts, want.accounts) {
+		t.Errorf("accounts are %v, want %v", got.accounts, want.accounts)
+	}
+	if !reflect.DeepEqual(got.prices, want.prices) {
+		t.Errorf("prices are %v, want %v", got.prices, want.prices)
+	}
+	if !reflect.DeepEqual(got.holdings, want.holdings) {
+		t.Errorf("holdings are %+v, want %+v", got.holdings, want.holdings)
+	}
+	if !reflect.DeepEqual(got.periodic, want.periodic) {
+		t.Errorf("periodic transactions are %+v, want %+v", got.periodic, want.periodic)
+	}
+	if len(got.automated) != len(want.automated) || got.automated[0].Query != want.automated[0].Query {
+		t.Errorf("automated transactions are %+v, want %+v", got.automated, want.automated)
+	}
+
+	for i, journal := range got.journals {
+		if len(journal.Items) != len(want.journals[i].Items) {
+			t.Errorf("journal %s has %d items, want %d", journal.File, len(journal.Items), len(want.journals[i].Items))
+			continue
+		}
+		for j, item := range journal.Items {
+			if item.Text != want.journals[i].Items[j].Text {
+				t.Errorf("item %d of %s is %q, want %q", j, journal.File, item.Text, want.journals[i].Items[j].Text)
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package Interpreter
+
+import (
+	AST "gledger/ast"
+	"sort"
+	"strings"
+	"time"
+)
+
+/**
+ * ReportOptions narrow down which postings a report looks at.
+ * The zero value includes everything.
+ */
+type ReportOptions struct {
+	Statuses []AST.Status // only postings with one of these statuses, all of them when empty
+	Tags     []TagFilter  // postings must carry every one of these tags
+
+	Market    bool      // convert balances into the configured currency at market prices
+	ValueDate time.Time // prices on or before this date are used, when zero the last day of the report or today
+
+	Forecast time.Time // add periodic transactions after the last real one, up to this date
+
+	Real bool // leave out (virtual) and [balanced virtual] postings
+
+	Begin     time.Time // only postings on or after this date, when set
+	End       time.Time // only postings before this date, when set
+	Effective bool      // use clearing dates (2025-01-30=2025-02-02, date: tags) instead of transaction dates
+}
+
+// A report ending on End shows what things were worth on its last day, End itself is not part of it
+func (options ReportOptions) valueDate() time.Time {
+	switch {
+	case !options.ValueDate.IsZero():
+		return options.ValueDate
+	case !options.End.IsZero():
+		return options.End.AddDate(0, 0, -1)
+	}
+	return time.Now()
+}
+
+// A tag to look for, an empty value matches any value
+type TagFilter struct {
+	Name  string
+	Value string
+}
+
+// Parse "name" or "name=value" as used on the command line
+func ParseTagFilter(filter string) TagFilter {
+	if separator := strings.Index(filter, "="); separator >= 0 {
+		return TagFilter{Name: filter[:separator], Value: filter[separator+1:]}
+	}
+	return TagFilter{Name: filter}
+}
+
+// Whether a single posting of the transaction is part of the report
+func (options ReportOptions) MatchesPosting(transaction *AST.Transaction, posting *AST.Posting) bool {
+	if options.Real && posting.Kind != AST.POSTING_REAL {
+		return false
+	}
+
+	date := transaction.PostingDate(posting, options.Effective)
+	if (!options.Begin.IsZero() && date.Before(options.Begin)) || (!options.End.IsZero() && !date.Before(options.End)) {
+		return false
+	}
+
+	if len(options.Statuses) > 0 {
+		status := transaction.PostingStatus(posting)
+		matched := false
+		for _, wanted := range options.Statuses {
+			if status == wanted {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	for _, tag := range options.Tags {
+		value, exists := transaction.PostingTag(posting, tag.Name)
+		if !exists || (tag.Value != "" && value != tag.Value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+/**
+ * Transactions with at least one posting matching the options, plugins get
+ * the last word through their OnFilter hook.
+ */
+func (interpreter *Interpreter) FilterTransactions(options ReportOptions) []*AST.Transaction {
+	candidates := interpreter.transactions
+	if !options.Forecast.IsZero() {
+		candidates = append(append([]*AST.Transaction{}, candidates...), interpreter.forecast(options.Forecast)...)
+		sortByDate(candidates)
+	}
+
+	// Clearing dates can be anywhere, transaction dates are in order
+	if !options.Effective {
+		candidates = between(candidates, options.Begin, options.End)
+	}
+
+	var transactions []*AST.Transaction
+	for _, transaction := range candidates {
+		for i := range transaction.Postings {
+			if options.MatchesPosting(transaction, &transaction.Postings[i]) {
+				transactions = append(transactions, transaction)
+				break
+			}
+		}
+	}
+	return interpreter.plugins.ExecuteOnFilter(transactions)
+}
+
+// Stable, transactions of the same day stay in the order they were written
+func sortByDate(transactions []*AST.Transaction) {
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Date.Before(transactions[j].Date)
+	})
+}
+
+// The transactions dated from begin up to end, found by binary search in transactions sorted by date
+func between(transactions []*AST.Transaction, begin, end time.Time) []*AST.Transaction {
+	first, last := 0, len(transactions)
+	if !begin.IsZero() {
+		first = sort.Search(len(transactions), func(i int) bool {
+			return !transactions[i].Date.Before(begin)
+		})
+	}
+	if !end.IsZero() {
+		last = sort.Search(len(transactions), func(i int) bool {
+			return !transactions[i].Date.Before(end)
+		})
+	}
+	return transactions[first:max(first, last)]
+}
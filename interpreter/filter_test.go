@@ -0,0 +1,122 @@
+package Interpreter
+
+import (
+	AST "gledger/ast"
+	Parser "gledger/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const virtualJournal = `2025-01-05 Dinner with Alice, I paid
+    expenses:dining        $60.00
+    assets:checking
+    [owed:alice]           $30.00
+    [owed:me]
+
+2025-01-06 Envelope
+    (budget:fun)           $100.00
+    (budget:groceries)     $50.00
+`
+
+/**
+ * (account) postings are left out when balancing, [account] postings
+ * balance among themselves and can have their own elided posting.
+ */
+func TestVirtualPostings(t *testing.T) {
+	interpreter, err := loadText(t, virtualJournal)
+	if err != nil {
+		t.Fatalf("loading failed: %v", err)
+	}
+
+	checkPostings(t, interpreter, map[string][]string{
+		"Dinner with Alice, I paid": {"expenses:dining $60.00", "assets:checking -$60.00", "owed:alice $30.00", "owed:me -$30.00"},
+		"Envelope":                  {"budget:fun $100.00", "budget:groceries $50.00"},
+	})
+
+	kinds := map[string]AST.PostingKind{}
+	for _, transaction := range interpreter.transactions {
+		for _, posting := range transaction.Postings {
+			kinds[posting.Account] = posting.Kind
+		}
+	}
+	for account, kind := range map[string]AST.PostingKind{
+		"expenses:dining": AST.POSTING_REAL,
+		"owed:alice":      AST.POSTING_BALANCED_VIRTUAL,
+		"budget:fun":      AST.POSTING_VIRTUAL,
+	} {
+		if kinds[account] != kind {
+			t.Errorf("%s is of kind %v, want %v", account, kinds[account], kind)
+		}
+	}
+}
+
+// Real leaves the virtual postings out of reports
+func TestRealReport(t *testing.T) {
+	interpreter, err := loadText(t, virtualJournal)
+	if err != nil {
+		t.Fatalf("loading failed: %v", err)
+	}
+
+	all := interpreter.CalculateBalances(ReportOptions{})
+	real := interpreter.CalculateBalances(ReportOptions{Real: true})
+	for _, account := range []string{"owed:alice", "owed:me", "budget:fun"} {
+		if all[account].IsZero() {
+			t.Errorf("%s is missing from the report", account)
+		}
+		if !real[account].IsZero() {
+			t.Errorf("%s is in the report of real postings with %s", account, real[account].String())
+		}
+	}
+	if got := real["assets:checking"].String(); got != "-$60.00" {
+		t.Errorf("assets:checking is %s in the report of real postings, want -$60.00", got)
+	}
+}
+
+func TestVirtualPostingErrors(t *testing.T) {
+	for journal, want := range map[string]string{
+		"2025-01-05 Dinner\n    expenses:dining    $60.00\n    assets:checking\n    [owed:alice]    $30.00\n    [owed:me]    $-20.00\n": "Transaction is not balanced (sum: [$10.00])",
+		"2025-01-05 Dinner\n    expenses:dining    $60.00\n    assets:checking\n    (budget:fun)\n":                                     "virtual postings need an amount",
+	} {
+		if _, err := loadText(t, journal); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got %v, want an error saying %q", err, want)
+		}
+	}
+}
+
+// An added transaction is written with the brackets of its postings
+func TestVirtualPostingsSaved(t *testing.T) {
+	interpreter, err := loadText(t, virtualJournal)
+	if err != nil {
+		t.Fatalf("loading failed: %v", err)
+	}
+
+	added, err := Parser.ParseTransactions("2025-01-07 Lunch\n    expenses:dining    $20.00\n    assets:checking\n    [owed:bob]    $10.00\n    [owed:me]\n    (budget:fun)    $-20.00\n", Parser.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := interpreter.AddTransaction(added[0]); err != nil {
+		t.Fatalf("adding failed: %v", err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "saved.journal")
+	if err := interpreter.SaveToFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := loadText(t, string(saved))
+	if err != nil {
+		t.Fatalf("loading the saved journal failed: %v\n%s", err, saved)
+	}
+	checkPostings(t, reloaded, map[string][]string{
+		"Lunch": {"expenses:dining $20.00", "assets:checking -$20.00", "owed:bob $10.00", "owed:me -$10.00", "budget:fun -$20.00"},
+	})
+	if !strings.Contains(string(saved), "[owed:bob]") || !strings.Contains(string(saved), "(budget:fun)") {
+		t.Errorf("the brackets were lost:\n%s", saved)
+	}
+}
@@ -0,0 +1,184 @@
+package Interpreter
+
+import (
+	"fmt"
+	AST "gledger/ast"
+	Parser "gledger/parser"
+	"gledger/utils"
+	"path/filepath"
+	"strings"
+)
+
+/**
+ * journalLoader follows include directives. Paths are relative to the file
+ * doing the include and can be globs: include 2024/*.journal
+ */
+type journalLoader struct {
+	journals  []*AST.Journal
+	files     []cachedFile // the journals as they were read, for the cache
+	includes  []includeMatch
+	order     []itemRef // transactions, periodic and automated transactions in the order they were read
+	loaded    map[string]bool
+	options   Parser.Options
+	declared  map[string]AST.AccountType // the accounts declared so far, includes followed
+	unknown   Parser.Diagnostics         // postings to accounts that were not declared before, in strict mode
+	prices    PriceHistory
+	periodic  []*AST.PeriodicTransaction
+	automated []*AST.AutomatedTransaction
+}
+
+// An item of one of the journals of the loader, by index
+type itemRef struct {
+	journal, item int
+}
+
+func (loader *journalLoader) load(filename string, including []string) ([]*AST.Transaction, error) {
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error resolving %s: %v", filename, err)
+	}
+
+	for _, parent := range including {
+		if parent == filename {
+			return nil, fmt.Errorf("Include cycle: %s -> %s", strings.Join(including, " -> "), filename)
+		}
+	}
+
+	if loader.loaded[filename] {
+		return nil, fmt.Errorf("%s is included more than once", filename)
+	}
+	loader.loaded[filename] = true
+
+	// The diagnostics already say which file they are about. Accounts are checked below, once the includes before them were followed
+	options := loader.options
+	options.File = filename
+	options.Strict = false
+	journal, read, err := parseCached(filename, options)
+	if err != nil {
+		return nil, err
+	}
+	index := len(loader.journals)
+	loader.journals = append(loader.journals, journal)
+	loader.files = append(loader.files, read)
+
+	// Included transactions take the place of the include directive
+	var transactions []*AST.Transaction
+	for i, item := range journal.Items {
+		switch {
+		case item.Kind == AST.ITEM_TRANSACTION:
+			loader.checkAccounts(item, item.Transaction, filename)
+			setFile(item.Transaction, filename)
+			transactions = append(transactions, item.Transaction)
+			loader.order = append(loader.order, itemRef{index, i})
+
+		case item.Kind == AST.ITEM_PERIODIC:
+			loader.checkAccounts(item, item.Periodic.Transaction, filename)
+			setFile(item.Periodic.Transaction, filename)
+			loader.periodic = append(loader.periodic, item.Periodic)
+			loader.order = append(loader.order, itemRef{index, i})
+
+		case item.Kind == AST.ITEM_AUTOMATED:
+			loader.checkAccounts(item, item.Automated.Transaction, filename)
+			setFile(item.Automated.Transaction, filename)
+			loader.automated = append(loader.automated, item.Automated)
+			loader.order = append(loader.order, itemRef{index, i})
+
+		case item.Kind == AST.ITEM_DIRECTIVE && item.Directive.Name == "account":
+			Parser.ApplyDirectives([]*AST.Item{item}, &Parser.Options{Accounts: loader.declared})
+
+		case item.Kind == AST.ITEM_DIRECTIVE && item.Directive.Price != nil:
+			loader.prices.Add(*item.Directive.Price)
+
+		case item.Kind == AST.ITEM_DIRECTIVE && item.Directive.Name == "include":
+			included, err := loader.include(item.Directive.Argument, filename, append(including, filename))
+			if _, isDiagnostics := err.(Parser.Diagnostics); isDiagnostics {
+				return nil, err
+			} else if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", filename, item.Line, err)
+			}
+			transactions = append(transactions, included...)
+		}
+	}
+
+	return transactions, nil
+}
+
+// In strict mode every account has to be declared before, in the file or in one included earlier
+func (loader *journalLoader) checkAccounts(item *AST.Item, transaction *AST.Transaction, filename string) {
+	if !loader.options.Strict {
+		return
+	}
+	err := Parser.CheckAccounts(item, transaction, Parser.Options{File: filename, Accounts: loader.declared})
+	if diagnostic, isDiagnostic := err.(*Parser.Diagnostic); isDiagnostic {
+		loader.unknown = append(loader.unknown, diagnostic)
+	}
+}
+
+func setFile(transaction *AST.Transaction, filename string) {
+	transaction.Position.File = filename
+	for i := range transaction.Postings {
+		transaction.Postings[i].Position.File = filename
+	}
+}
+
+func (loader *journalLoader) include(pattern, from string, including []string) ([]*AST.Transaction, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("include needs a path")
+	}
+
+	pattern = utils.ExpandHome(pattern)
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(from), pattern)
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid include pattern %s: %v", pattern, err)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("No files match include %s", pattern)
+	}
+	loader.includes = append(loader.includes, includeMatch{Pattern: pattern, Matches: matches})
+
+	var transactions []*AST.Transaction
+	for _, match := range matches {
+		included, err := loader.load(match, including)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, included...)
+	}
+
+	return transactions, nil
+}
+
+/**
+ * New transactions go next to their neighbours: into the file holding the
+ * latest transaction on or before their date, or the earliest one when
+ * they come first. An empty ledger gets them in the main file.
+ */
+func (interpreter *Interpreter) journalFor(transaction *AST.Transaction) *AST.Journal {
+	var neighbour, earliest *AST.Transaction
+	for _, existing := range interpreter.transactions {
+		if earliest == nil || existing.Date.Before(earliest.Date) {
+			earliest = existing
+		}
+		if !existing.Date.After(transaction.Date) && (neighbour == nil || !existing.Date.Before(neighbour.Date)) {
+			neighbour = existing
+		}
+	}
+
+	if neighbour == nil {
+		neighbour = earliest
+	}
+
+	if neighbour != nil {
+		for _, journal := range interpreter.journals {
+			if journal.File == neighbour.Position.File {
+				return journal
+			}
+		}
+	}
+
+	return interpreter.journals[0]
+}
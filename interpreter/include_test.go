@@ -0,0 +1,48 @@
+package Interpreter
+
+import (
+	"errors"
+	"gledger/config"
+	Parser "gledger/parser"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Accounts declared in an included file can be used after the include, not before
+func TestIncludeStrictAccounts(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	directory := t.TempDir()
+	writeJournal(t, filepath.Join(directory, "accounts.journal"), "account expenses:food\naccount assets:checking\n")
+
+	strict := config.DefaultConfig()
+	strict.Strict = true
+
+	filename := filepath.Join(directory, "main.journal")
+	writeJournal(t, filename, "include accounts.journal\n\n2025-01-02 Groceries\n    expenses:food    $42.50\n    assets:checking\n")
+	for _, pass := range []string{"parsed", "cached"} {
+		interpreter := NewInterpreter(strict)
+		if err := interpreter.LoadFromFile(filename); err != nil {
+			t.Fatalf("%s: an account declared in an included file was rejected: %v", pass, err)
+		}
+		if len(interpreter.transactions) != 1 {
+			t.Errorf("%s: got %d transactions, want 1", pass, len(interpreter.transactions))
+		}
+	}
+
+	filename = filepath.Join(directory, "before.journal")
+	writeJournal(t, filename, "2025-01-02 Groceries\n    expenses:food    $42.50\n    assets:checking\n\ninclude accounts.journal\n")
+	err := NewInterpreter(strict).LoadFromFile(filename)
+
+	var diagnostics Parser.Diagnostics
+	if !errors.As(err, &diagnostics) || len(diagnostics) != 1 {
+		t.Fatalf("got %v, want one diagnostic", err)
+	}
+	diagnostic := diagnostics[0]
+	if diagnostic.File != filename || diagnostic.Line != 2 || diagnostic.Column != 5 || !strings.Contains(diagnostic.Message, `Unknown account "expenses:food"`) {
+		t.Errorf("got %s:%d:%d %s, want the account used before the include", diagnostic.File, diagnostic.Line, diagnostic.Column, diagnostic.Message)
+	}
+	if diagnostic.Source != "    expenses:food    $42.50" {
+		t.Errorf("the diagnostic shows %q instead of the posting", diagnostic.Source)
+	}
+}
@@ -4,17 +4,27 @@ import (
 	"fmt"
 	AST "gledger/ast"
 	"gledger/config"
+	"gledger/decimal"
 	Parser "gledger/parser"
 	Plugin "gledger/plugin"
 	TemplatePlugin "gledger/plugin/extentions"
+	"gledger/utils"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 )
 
 type Interpreter struct {
 	transactions []*AST.Transaction
+	journals     []*AST.Journal             // the files as they were written, the main one first
+	accounts     map[string]AST.AccountType // declared with the account directive
+	prices       PriceHistory
+	holdings     *Holdings                   // investment lots and realized gains
+	periodic     []*AST.PeriodicTransaction  // ~ budgets and forecasts, never saved as transactions
+	budgets      []*AST.PeriodicTransaction  // monthly budgets from the config
+	automated    []*AST.AutomatedTransaction // = rules adding postings to matching transactions
 	plugins      *Plugin.PluginManager
 	config       *config.Config
 }
@@ -22,6 +32,10 @@ type Interpreter struct {
 func NewInterpreter(config *config.Config) *Interpreter {
 	interpreter := &Interpreter{
 		transactions: []*AST.Transaction{},
+		journals:     []*AST.Journal{{}},
+		accounts:     map[string]AST.AccountType{},
+		prices:       PriceHistory{},
+		holdings:     &Holdings{Lots: map[string][]*Lot{}},
 		plugins:      Plugin.NewPluginManager(),
 		config:       config,
 	}
@@ -33,7 +47,10 @@ func NewInterpreter(config *config.Config) *Interpreter {
 	return interpreter
 }
 
-func (interpreter *Interpreter) LoadFromFile(filename string) error {
+func (interpreter *Interpreter) LoadFromFile(filename string) (err error) {
+	// Totals of numbers that fit on their own can still be too large
+	defer decimal.Recover(&err)
+
 	if strings.HasPrefix(filename, "~/") {
 		home, err := os.UserHomeDir()
 		if err != nil {
@@ -42,26 +59,137 @@ func (interpreter *Interpreter) LoadFromFile(filename string) error {
 		filename = filepath.Join(home, filename[2:])
 	}
 
-	data, err := os.ReadFile(filename)
+	if err := interpreter.checkAccountTypes(); err != nil {
+		return err
+	}
+
+	if err := interpreter.loadBudgets(); err != nil {
+		return err
+	}
+
+	method, err := interpreter.lotMethod()
 	if err != nil {
-		return fmt.Errorf("Error reading file: %v", err)
+		return err
 	}
 
-	transactions, err := Parser.ParseTransactions(string(data))
+	ledger, err := interpreter.loadLedger(filename, Parser.Options{
+		Strict:     interpreter.config.Strict,
+		Accounts:   map[string]AST.AccountType{},
+		DateFormat: interpreter.config.DateFormat,
+	}, method)
 	if err != nil {
-		return fmt.Errorf("Parse error: %v", err)
+		return err
 	}
 
-	for _, transaction := range transactions {
+	for _, transaction := range ledger.loaded {
 		if err := interpreter.plugins.ExecuteOnParse(transaction); err != nil {
 			return fmt.Errorf("Plugin OnParse error: %v", err)
 		}
 	}
 
-	interpreter.transactions = transactions
+	interpreter.transactions = ledger.transactions
+	interpreter.journals = ledger.journals
+	interpreter.accounts = ledger.accounts
+	interpreter.prices = ledger.prices
+	interpreter.holdings = ledger.holdings
+	interpreter.periodic = ledger.periodic
+	interpreter.automated = ledger.automated
+
+	if interpreter.config.PricesFile != "" {
+		if err := interpreter.loadPricesFile(filename); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// What loading works out from the journals, the cache keeps it for the next load
+type loadedLedger struct {
+	journals     []*AST.Journal
+	order        []itemRef          // where the transactions, periodic and automated transactions are, in the order they were read
+	loaded       []*AST.Transaction // in that order
+	transactions []*AST.Transaction // by date
+	accounts     map[string]AST.AccountType
+	prices       PriceHistory
+	holdings     *Holdings
+	periodic     []*AST.PeriodicTransaction
+	automated    []*AST.AutomatedTransaction
+}
+
+/**
+ * Read the journals of filename and work out automated postings, balance
+ * assignments, lots and prices. When none of the journals changed since the
+ * last load all of it comes from the cache instead.
+ */
+func (interpreter *Interpreter) loadLedger(filename string, options Parser.Options, method LotMethod) (*loadedLedger, error) {
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Error resolving %s: %v", filename, err)
+	}
+
+	settings := ledgerSettings(options, method)
+	if ledger := readLedger(filename, settings); ledger != nil {
+		return ledger, nil
+	}
+
+	loader := &journalLoader{
+		loaded:   map[string]bool{},
+		prices:   PriceHistory{},
+		options:  options,
+		declared: map[string]AST.AccountType{},
+	}
+	transactions, err := loader.load(filename, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(loader.unknown) > 0 {
+		return nil, loader.unknown
+	}
+
+	interpreter.automated = loader.automated
+	for _, transaction := range transactions {
+		if transaction.HasBalanceAssignments() {
+			continue
+		}
+		if err := interpreter.applyAutomated(transaction); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := interpreter.checkBalances(transactions); err != nil {
+		return nil, err
+	}
+
+	holdings, err := trackLots(transactions, method)
+	if err != nil {
+		return nil, err
+	}
+
+	// In date order, like after AddTransaction, so reports can look dates up
+	byDate := append([]*AST.Transaction{}, transactions...)
+	sortByDate(byDate)
+	loader.prices.addCosts(byDate)
+
+	ledger := &loadedLedger{
+		journals:     loader.journals,
+		order:        loader.order,
+		loaded:       transactions,
+		transactions: byDate,
+		accounts:     loader.options.Accounts,
+		prices:       loader.prices,
+		holdings:     holdings,
+		periodic:     loader.periodic,
+		automated:    loader.automated,
+	}
+	writeLedger(filename, settings, loader, ledger)
+	return ledger, nil
+}
+
+/**
+ * The main journal is written to filename, included files only when
+ * something was added to them.
+ */
 func (interpreter *Interpreter) SaveToFile(filename string) error {
 	if strings.HasPrefix(filename, "~/") {
 		home, err := os.UserHomeDir()
@@ -71,17 +199,37 @@ func (interpreter *Interpreter) SaveToFile(filename string) error {
 		filename = filepath.Join(home, filename[2:])
 	}
 
+	for i, journal := range interpreter.journals {
+		target := journal.File
+		if i == 0 {
+			target = filename
+		} else if !journal.Modified {
+			continue
+		}
+
+		if err := interpreter.writeJournal(journal, target); err != nil {
+			return err
+		}
+		journal.Modified = false
+	}
+
+	return nil
+}
+
+func (interpreter *Interpreter) writeJournal(journal *AST.Journal, filename string) error {
 	dir := filepath.Dir(filename)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("Error creating directories: %v", err)
 	}
 
+	// Untouched items are written back exactly as they were read
 	var output strings.Builder
-	for i, transaction := range interpreter.transactions {
-		if i > 0 {
-			output.WriteString("\n")
+	for _, item := range journal.Items {
+		if item.Text == "" && item.Kind == AST.ITEM_TRANSACTION {
+			output.WriteString(interpreter.formatTransaction(item.Transaction))
+			continue
 		}
-		output.WriteString(interpreter.formatTransaction(transaction))
+		output.WriteString(item.Text)
 	}
 
 	return os.WriteFile(filename, []byte(output.String()), 0644)
@@ -90,36 +238,131 @@ func (interpreter *Interpreter) SaveToFile(filename string) error {
 func (interpreter *Interpreter) formatTransaction(transaction *AST.Transaction) string {
 	var formatted strings.Builder
 
-	formatted.WriteString(fmt.Sprintf("%s %s\n", transaction.Date.Format("2006-01-02"), transaction.Description))
+	formatted.WriteString(interpreter.formatDate(transaction.Date))
+	if !transaction.EffectiveDate.IsZero() {
+		formatted.WriteString("=" + interpreter.formatDate(transaction.EffectiveDate))
+	}
+	if marker := transaction.Status.Marker(); marker != "" {
+		formatted.WriteString(" " + marker)
+	}
+	formatted.WriteString(" " + transaction.Description + "\n")
+
+	for _, comment := range transaction.Comments {
+		formatted.WriteString(fmt.Sprintf("    ; %s\n", comment))
+	}
+
+	elidedWritten := map[AST.PostingKind]bool{}
 	for _, posting := range transaction.Postings {
-		formatted.WriteString(fmt.Sprintf("  %-40s %10.2f\n", posting.Account, posting.Amount.Value))
+		// Automated transactions add these again when the journal is loaded
+		if posting.Generated {
+			continue
+		}
+
+		account := posting.WrittenAccount()
+		if marker := posting.Status.Marker(); marker != "" {
+			account = marker + " " + account
+		}
+
+		// Keep the elided form, an inferred posting split per commodity is written once
+		var line string
+		if posting.Elided {
+			if elidedWritten[posting.Kind] {
+				continue
+			}
+			elidedWritten[posting.Kind] = true
+			line = fmt.Sprintf("  %s", account)
+		} else if posting.Assigned {
+			line = fmt.Sprintf("  %-40s ", account)
+		} else {
+			// Two spaces at least, a single one would make the amount part of the account name
+			line = fmt.Sprintf("  %-40s  %9s", account, posting.Amount.String())
+		}
+
+		if posting.Lot != nil {
+			line += " {" + posting.Lot.Cost.String() + "}"
+			if !posting.Lot.Date.IsZero() {
+				line += " [" + interpreter.formatDate(posting.Lot.Date) + "]"
+			}
+		}
+
+		if posting.Price != nil {
+			if posting.TotalPrice {
+				line += " @@ " + posting.Price.String()
+			} else {
+				line += " @ " + posting.Price.String()
+			}
+		}
+
+		if posting.Assertion != nil {
+			line += " = " + posting.Assertion.String()
+		}
+
+		// First comment goes on the posting line, the rest below it
+		for i, comment := range posting.Comments {
+			if i == 0 {
+				line += "  ; " + comment
+			} else {
+				line += "\n    ; " + comment
+			}
+		}
+		formatted.WriteString(line + "\n")
 	}
 
 	return formatted.String()
 }
 
-func (interpreter *Interpreter) CalculateBalances() map[string]float64 {
-	balances := make(map[string]float64)
-	for _, transaction := range interpreter.transactions {
+// Dates are shown and written in the configured format
+func (interpreter *Interpreter) formatDate(date time.Time) string {
+	return date.Format(interpreter.config.DateLayout())
+}
+
+func (interpreter *Interpreter) CalculateBalances(options ReportOptions) map[string]AST.Balance {
+	balances := make(map[string]AST.Balance)
+	for _, transaction := range interpreter.FilterTransactions(options) {
 		for _, posting := range transaction.Postings {
-			balances[posting.Account] += posting.Amount.Value
+			if !options.MatchesPosting(transaction, &posting) {
+				continue
+			}
+			if balances[posting.Account] == nil {
+				balances[posting.Account] = AST.Balance{}
+			}
+			balances[posting.Account].Add(posting.Amount)
+		}
+	}
+
+	if options.Market {
+		for account, balance := range balances {
+			balances[account] = interpreter.marketValue(balance, options.valueDate())
 		}
 	}
+
 	return balances
 }
 
-func (interpreter *Interpreter) GenerateBalanceReport() string {
-	balances := interpreter.CalculateBalances()
+// Report sections in the order they are printed, accounts without a type go last
+var reportSections = []struct {
+	accountType AST.AccountType
+	title       string
+}{
+	{AST.ACCOUNT_ASSET, "ASSETS"},
+	{AST.ACCOUNT_LIABILITY, "LIABILITIES"},
+	{AST.ACCOUNT_EQUITY, "EQUITY"},
+	{AST.ACCOUNT_INCOME, "INCOME"},
+	{AST.ACCOUNT_EXPENSE, "EXPENSES"},
+	{AST.ACCOUNT_UNKNOWN, "OTHER"},
+}
+
+func (interpreter *Interpreter) GenerateBalanceReport(options ReportOptions) string {
+	balances := interpreter.CalculateBalances(options)
 
-	// Group by account type (first part before colon)
-	groups := make(map[string]map[string]float64)
+	// Group by account type
+	groups := make(map[AST.AccountType]map[string]AST.Balance)
 
 	for account, balance := range balances {
-		parts := strings.Split(account, ":")
-		accountType := parts[0]
+		accountType := interpreter.AccountType(account)
 
 		if groups[accountType] == nil {
-			groups[accountType] = make(map[string]float64)
+			groups[accountType] = make(map[string]AST.Balance)
 		}
 		groups[accountType][account] = balance
 	}
@@ -128,16 +371,13 @@ func (interpreter *Interpreter) GenerateBalanceReport() string {
 	report.WriteString("BALANCE REPORT\n")
 	report.WriteString("══════════════════════════════════════════════\n\n")
 
-	// Define order for account types
-	order := []string{"assets", "liabilities", "equity", "income", "expenses"}
-
-	for _, accountType := range order {
-		accounts := groups[accountType]
+	for _, section := range reportSections {
+		accounts := groups[section.accountType]
 		if len(accounts) == 0 {
 			continue
 		}
 
-		report.WriteString(fmt.Sprintf("%s:\n", strings.ToUpper(accountType)))
+		report.WriteString(fmt.Sprintf("%s:\n", section.title))
 
 		// Sort accounts within group
 		var names []string
@@ -146,20 +386,30 @@ func (interpreter *Interpreter) GenerateBalanceReport() string {
 		}
 		sort.Strings(names)
 
-		total := 0.0
+		total := AST.Balance{}
 		for _, name := range names {
 			balance := accounts[name]
-			total += balance
-			report.WriteString(fmt.Sprintf("  %-40s %10.2f\n", name, balance))
+			total.AddBalance(balance)
+			writeBalanceLines(&report, name, balance)
 		}
 
-		report.WriteString(fmt.Sprintf("  %-40s %10.2f\n", "Total", total))
+		writeBalanceLines(&report, "Total", total)
 		report.WriteString("\n")
 	}
 
 	return report.String()
 }
 
+// One line per commodity, the name only on the first one
+func writeBalanceLines(report *strings.Builder, name string, balance AST.Balance) {
+	for i, amount := range balance.Amounts() {
+		if i > 0 {
+			name = ""
+		}
+		report.WriteString(fmt.Sprintf("  %-40s %14s\n", name, amount.String()))
+	}
+}
+
 func (interpreter *Interpreter) GetPluginReports() []string {
 	return interpreter.plugins.ExecuteOnReport(interpreter.transactions)
 }
@@ -168,20 +418,60 @@ func (interpreter *Interpreter) GetTransactions() []*AST.Transaction {
 	return interpreter.transactions
 }
 
-func (interpreter *Interpreter) AddTransaction(transaction *AST.Transaction) error {
+func (interpreter *Interpreter) AddTransaction(transaction *AST.Transaction) (err error) {
+	defer decimal.Recover(&err)
+
 	if !transaction.IsBalanced() {
-		return fmt.Errorf("Transaction is not balanced: sum is %.2f", transaction.Balance())
+		return fmt.Errorf("Transaction is not balanced: sum is %s", transaction.Imbalance())
+	}
+
+	if !transaction.HasBalanceAssignments() {
+		if err := interpreter.applyAutomated(transaction); err != nil {
+			return err
+		}
+	}
+
+	for _, posting := range transaction.Postings {
+		if err := interpreter.CheckAccount(posting.Account); err != nil {
+			return err
+		}
+	}
+
+	// A transaction dated before an assertion changes what it sees
+	if err := interpreter.checkBalances(append(interpreter.transactions, transaction)); err != nil {
+		// Balance assignments were worked out with the rejected transaction, undo that
+		interpreter.checkBalances(interpreter.transactions)
+		return err
+	}
+
+	method, err := interpreter.lotMethod()
+	if err != nil {
+		return err
+	}
+	holdings, err := trackLots(append(interpreter.transactions, transaction), method)
+	if err != nil {
+		return err
 	}
 
 	if err := interpreter.plugins.ExecuteOnAdd(transaction); err != nil {
 		return fmt.Errorf("Plugin OnAdd error: %v", err)
 	}
 
+	interpreter.journalFor(transaction).InsertTransaction(transaction)
 	interpreter.transactions = append(interpreter.transactions, transaction)
+	interpreter.holdings = holdings
+	sortByDate(interpreter.transactions)
 
-	sort.Slice(interpreter.transactions, func(i, j int) bool {
-		return interpreter.transactions[i].Date.Before(interpreter.transactions[j].Date)
-	})
+	return nil
+}
 
+// In strict mode only declared accounts can be used
+func (interpreter *Interpreter) CheckAccount(account string) error {
+	if !interpreter.config.Strict {
+		return nil
+	}
+	if _, declared := interpreter.accounts[account]; !declared {
+		return utils.UnknownAccountError(account, interpreter.accounts)
+	}
 	return nil
 }
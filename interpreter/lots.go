@@ -0,0 +1,404 @@
+package Interpreter
+
+import (
+	"fmt"
+	AST "gledger/ast"
+	"gledger/decimal"
+	"sort"
+	"strings"
+	"time"
+)
+
+/**
+ * Investments are held in lots: 10 VTI {$220.00} [2024-03-01] buys ten
+ * shares at $220.00 each. Selling takes shares out of the lots of the
+ * account, the oldest first (FIFO), the newest first (LIFO) or exactly the
+ * lot written on the sale, and every piece sold is a realized gain.
+ */
+
+// Shares of one purchase still held in an account
+type Lot struct {
+	Account  string
+	Quantity AST.Amount // 10 VTI
+	Cost     AST.Amount // per unit, $220.00
+	Date     time.Time  // when it was acquired
+}
+
+// Part of a lot that was sold
+type RealizedGain struct {
+	Date     time.Time // when it was sold
+	Account  string
+	Quantity AST.Amount
+	Acquired time.Time
+	Cost     AST.Amount // cost basis of the quantity sold
+	Proceeds AST.Amount
+	Gain     AST.Amount
+}
+
+// Held for more than a year
+func (gain RealizedGain) LongTerm() bool {
+	return isLongTerm(gain.Acquired, gain.Date)
+}
+
+func isLongTerm(acquired, sold time.Time) bool {
+	return sold.After(acquired.AddDate(1, 0, 0))
+}
+
+type LotMethod int
+
+const (
+	LOT_FIFO LotMethod = iota // oldest lots are sold first
+	LOT_LIFO                  // newest lots are sold first
+)
+
+// fifo or lifo, case-insensitive. Empty means fifo.
+func ParseLotMethod(method string) (LotMethod, error) {
+	switch strings.ToLower(strings.TrimSpace(method)) {
+	case "", "fifo":
+		return LOT_FIFO, nil
+	case "lifo":
+		return LOT_LIFO, nil
+	}
+	return LOT_FIFO, fmt.Errorf("Unknown lot method %q, use fifo or lifo", method)
+}
+
+// Lots held per account, oldest first, and everything sold so far
+type Holdings struct {
+	Lots  map[string][]*Lot
+	Gains []RealizedGain
+}
+
+/**
+ * Work out the lots in date order, transactions on the same day in the
+ * order they were read. Sales come before purchases within a transaction
+ * so shares moved between accounts without a price keep their lots. A
+ * "lot: lifo" tag on a posting overrides the method for that sale.
+ */
+func trackLots(transactions []*AST.Transaction, method LotMethod) (*Holdings, error) {
+	ordered := append([]*AST.Transaction{}, transactions...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Date.Before(ordered[j].Date)
+	})
+
+	holdings := &Holdings{Lots: map[string][]*Lot{}}
+
+	for _, transaction := range ordered {
+		// Lots taken out without a sale price, waiting for the account they move to
+		var moved []*Lot
+
+		for i := range transaction.Postings {
+			posting := &transaction.Postings[i]
+			if !posting.Amount.Value.IsNegative() {
+				continue
+			}
+
+			postingMethod := method
+			if tag, exists := transaction.PostingTag(posting, "lot"); exists {
+				parsed, err := ParseLotMethod(tag)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", posting.Position, err)
+				}
+				postingMethod = parsed
+			}
+
+			taken, err := holdings.take(posting, postingMethod)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", posting.Position, err)
+			}
+
+			if posting.Price == nil {
+				moved = append(moved, taken...)
+				continue
+			}
+			for _, lot := range taken {
+				holdings.Gains = append(holdings.Gains, realize(transaction, posting, lot))
+			}
+		}
+
+		for i := range transaction.Postings {
+			posting := &transaction.Postings[i]
+			if posting.Amount.Value.Sign() <= 0 {
+				continue
+			}
+
+			if posting.Lot != nil {
+				date := posting.Lot.Date
+				if date.IsZero() {
+					date = transaction.Date
+				}
+				holdings.add(&Lot{Account: posting.Account, Quantity: posting.Amount, Cost: posting.Lot.Cost, Date: date})
+				continue
+			}
+
+			moved = holdings.receive(posting, moved)
+		}
+	}
+
+	return holdings, nil
+}
+
+// Keep the lots of an account ordered by acquisition date
+func (holdings *Holdings) add(lot *Lot) {
+	lots := append(holdings.Lots[lot.Account], lot)
+	sort.SliceStable(lots, func(i, j int) bool {
+		return lots[i].Date.Before(lots[j].Date)
+	})
+	holdings.Lots[lot.Account] = lots
+}
+
+/**
+ * Take the quantity of a negative posting out of the lots of its account.
+ * Commodities the account holds no lots of are not tracked and give
+ * nothing back.
+ */
+func (holdings *Holdings) take(posting *AST.Posting, method LotMethod) ([]*Lot, error) {
+	commodity := posting.Amount.Commodity
+
+	var candidates []*Lot
+	available := decimal.Zero
+	for _, lot := range holdings.Lots[posting.Account] {
+		if lot.Quantity.Commodity != commodity {
+			continue
+		}
+		if posting.Lot != nil && !matchesLot(lot, posting.Lot) {
+			continue
+		}
+		candidates = append(candidates, lot)
+		available = available.Add(lot.Quantity.Value)
+	}
+
+	if len(candidates) == 0 {
+		if posting.Lot != nil {
+			return nil, fmt.Errorf("no lot of %s at %s in %s", commodity, posting.Lot.Cost.String(), posting.Account)
+		}
+		return nil, nil
+	}
+
+	wanted := posting.Amount.Value.Neg()
+	if available.Cmp(wanted) < 0 {
+		return nil, fmt.Errorf("can not sell %s %s from %s, its lots only hold %s", wanted, commodity, posting.Account, available)
+	}
+
+	if method == LOT_LIFO && posting.Lot == nil {
+		for i, j := 0, len(candidates)-1; i < j; i, j = i+1, j-1 {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		}
+	}
+
+	var taken []*Lot
+	for _, lot := range candidates {
+		if wanted.IsZero() {
+			break
+		}
+
+		quantity := lot.Quantity.Value
+		if quantity.Cmp(wanted) > 0 {
+			quantity = wanted
+		}
+
+		part := *lot
+		part.Quantity.Value = quantity
+		taken = append(taken, &part)
+
+		lot.Quantity.Value = lot.Quantity.Value.Sub(quantity)
+		wanted = wanted.Sub(quantity)
+	}
+
+	holdings.removeEmpty(posting.Account)
+	return taken, nil
+}
+
+// {$220.00} matches lots bought at that cost, [2024-03-01] narrows it down to that day
+func matchesLot(lot *Lot, wanted *AST.Lot) bool {
+	if lot.Cost.Commodity != wanted.Cost.Commodity || !lot.Cost.Value.Equal(wanted.Cost.Value) {
+		return false
+	}
+	return wanted.Date.IsZero() || lot.Date.Equal(wanted.Date)
+}
+
+func (holdings *Holdings) removeEmpty(account string) {
+	var remaining []*Lot
+	for _, lot := range holdings.Lots[account] {
+		if !lot.Quantity.Value.IsZero() {
+			remaining = append(remaining, lot)
+		}
+	}
+
+	if len(remaining) == 0 {
+		delete(holdings.Lots, account)
+		return
+	}
+	holdings.Lots[account] = remaining
+}
+
+// Lots moved from another account keep their cost and date, returns the ones left over
+func (holdings *Holdings) receive(posting *AST.Posting, moved []*Lot) []*Lot {
+	wanted := posting.Amount.Value
+	var left []*Lot
+
+	for _, lot := range moved {
+		if wanted.IsZero() || lot.Quantity.Commodity != posting.Amount.Commodity {
+			left = append(left, lot)
+			continue
+		}
+
+		quantity := lot.Quantity.Value
+		if quantity.Cmp(wanted) > 0 {
+			quantity = wanted
+			rest := *lot
+			rest.Quantity.Value = lot.Quantity.Value.Sub(quantity)
+			left = append(left, &rest)
+		}
+
+		received := *lot
+		received.Account = posting.Account
+		received.Quantity.Value = quantity
+		holdings.add(&received)
+
+		wanted = wanted.Sub(quantity)
+	}
+
+	return left
+}
+
+// The gain of selling part of a lot at the price of the posting
+func realize(transaction *AST.Transaction, posting *AST.Posting, lot *Lot) RealizedGain {
+	cost := lot.Cost
+	cost.Value = lot.Quantity.Value.Mul(lot.Cost.Value)
+
+	proceeds := *posting.Price
+	if posting.TotalPrice {
+		// The share of the total price for this part of the sale
+		sold := posting.Amount.Value.Abs()
+		proceeds.Value = posting.Price.Value.Mul(lot.Quantity.Value).Div(sold, posting.Price.Value.Scale())
+	} else {
+		proceeds.Value = lot.Quantity.Value.Mul(posting.Price.Value)
+	}
+
+	gain := proceeds
+	if proceeds.Commodity == cost.Commodity {
+		gain.Value = proceeds.Value.Sub(cost.Value)
+	} else {
+		// Sold for something else than what it cost, there is no gain to work out
+		gain.Value = decimal.Zero
+		gain.Commodity = cost.Commodity
+		gain.Style = cost.Style
+	}
+
+	return RealizedGain{
+		Date:     transaction.Date,
+		Account:  posting.Account,
+		Quantity: lot.Quantity,
+		Acquired: lot.Date,
+		Cost:     cost,
+		Proceeds: proceeds,
+		Gain:     gain,
+	}
+}
+
+func (interpreter *Interpreter) lotMethod() (LotMethod, error) {
+	method, err := ParseLotMethod(interpreter.config.LotMethod)
+	if err != nil {
+		return method, fmt.Errorf("Config lot_method: %v", err)
+	}
+	return method, nil
+}
+
+func (interpreter *Interpreter) GetHoldings() *Holdings {
+	return interpreter.holdings
+}
+
+/**
+ * Realized gains split in short and long term, then the unrealized gains
+ * of the lots still held, valued with the latest prices on or before the
+ * value date of the options.
+ */
+func (interpreter *Interpreter) GenerateGainsReport(options ReportOptions) string {
+	var report strings.Builder
+	report.WriteString("CAPITAL GAINS REPORT\n")
+	report.WriteString("══════════════════════════════════════════════\n\n")
+
+	for _, longTerm := range []bool{false, true} {
+		title := "REALIZED, SHORT TERM"
+		if longTerm {
+			title = "REALIZED, LONG TERM"
+		}
+
+		total := AST.Balance{}
+		var lines []string
+		for _, gain := range interpreter.holdings.Gains {
+			if gain.LongTerm() != longTerm {
+				continue
+			}
+			total.Add(gain.Gain)
+			lines = append(lines, fmt.Sprintf("  %-10s  %-24s %12s  %-10s %12s %12s %12s\n",
+				interpreter.formatDate(gain.Date), gain.Account, gain.Quantity.String(), interpreter.formatDate(gain.Acquired),
+				gain.Cost.String(), gain.Proceeds.String(), gain.Gain.String()))
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		report.WriteString(fmt.Sprintf("%s:\n", title))
+		report.WriteString(fmt.Sprintf("  %-10s  %-24s %12s  %-10s %12s %12s %12s\n", "Sold", "Account", "Quantity", "Acquired", "Cost", "Proceeds", "Gain"))
+		for _, line := range lines {
+			report.WriteString(line)
+		}
+		writeGainTotal(&report, total, 87)
+	}
+
+	var accounts []string
+	for account := range interpreter.holdings.Lots {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+
+	if len(accounts) == 0 {
+		return report.String()
+	}
+
+	date := options.valueDate()
+	report.WriteString(fmt.Sprintf("UNREALIZED (prices of %s):\n", interpreter.formatDate(date)))
+	report.WriteString(fmt.Sprintf("  %-24s %12s  %-10s %12s %12s %12s  %s\n", "Account", "Quantity", "Acquired", "Cost", "Value", "Gain", "Term"))
+
+	total := AST.Balance{}
+	for _, account := range accounts {
+		for _, lot := range interpreter.holdings.Lots[account] {
+			cost := lot.Cost
+			cost.Value = lot.Quantity.Value.Mul(lot.Cost.Value)
+
+			term := "short"
+			if isLongTerm(lot.Date, date) {
+				term = "long"
+			}
+
+			value, gain := "no price", ""
+			if price, found := interpreter.prices.Latest(lot.Quantity.Commodity, lot.Cost.Commodity, date); found {
+				market := price
+				market.Value = lot.Quantity.Value.Mul(price.Value).Round(price.Value.Scale())
+				difference := market
+				difference.Value = market.Value.Sub(cost.Value)
+				total.Add(difference)
+				value, gain = market.String(), difference.String()
+			}
+
+			report.WriteString(fmt.Sprintf("  %-24s %12s  %-10s %12s %12s %12s  %s\n",
+				account, lot.Quantity.String(), interpreter.formatDate(lot.Date), cost.String(), value, gain, term))
+		}
+	}
+	writeGainTotal(&report, total, 75)
+
+	return report.String()
+}
+
+// The total lines up with the gain column, which starts after width characters
+func writeGainTotal(report *strings.Builder, total AST.Balance, width int) {
+	for i, amount := range total.Amounts() {
+		name := ""
+		if i == 0 {
+			name = "Total"
+		}
+		report.WriteString(fmt.Sprintf("  %-*s %12s\n", width, name, amount.String()))
+	}
+	report.WriteString("\n")
+}
@@ -0,0 +1,135 @@
+package Interpreter
+
+import (
+	"fmt"
+	Parser "gledger/parser"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const purchases = `2024-01-10 Buy
+    assets:brokerage       10 VTI {$200.00}
+    assets:cash
+
+2024-06-01 Buy
+    assets:brokerage       10 VTI {$220.00}
+    assets:cash
+
+`
+
+// The lots and gains trackLots works out from journal, one line each
+func trackJournal(t *testing.T, journal string, method LotMethod) ([]string, []string, error) {
+	t.Helper()
+	transactions, err := Parser.ParseTransactions(journal, Parser.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	holdings, err := trackLots(transactions, method)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var lots, gains []string
+	for _, account := range []string{"assets:brokerage", "assets:retirement"} {
+		for _, lot := range holdings.Lots[account] {
+			lots = append(lots, fmt.Sprintf("%s %s {%s} %s", lot.Account, lot.Quantity.String(), lot.Cost.String(), lot.Date.Format("2006-01-02")))
+		}
+	}
+	for _, gain := range holdings.Gains {
+		gains = append(gains, fmt.Sprintf("%s %s cost %s proceeds %s gain %s long %t",
+			gain.Quantity.String(), gain.Acquired.Format("2006-01-02"), gain.Cost.String(), gain.Proceeds.String(), gain.Gain.String(), gain.LongTerm()))
+	}
+	return lots, gains, nil
+}
+
+func checkLots(t *testing.T, journal string, method LotMethod, wantLots, wantGains []string) {
+	t.Helper()
+	lots, gains, err := trackJournal(t, journal, method)
+	if err != nil {
+		t.Fatalf("tracking the lots failed: %v", err)
+	}
+	if !slices.Equal(lots, wantLots) {
+		t.Errorf("got lots %q, want %q", lots, wantLots)
+	}
+	if !slices.Equal(gains, wantGains) {
+		t.Errorf("got gains %q, want %q", gains, wantGains)
+	}
+}
+
+const sale = `2025-03-01 Sell
+    assets:brokerage       -15 VTI @ $250.00
+    assets:cash            $3,750.00
+`
+
+// The oldest lot goes first, held more than a year it is a long term gain
+func TestLotsFIFO(t *testing.T) {
+	checkLots(t, purchases+sale, LOT_FIFO,
+		[]string{"assets:brokerage 5 VTI {$220.00} 2024-06-01"},
+		[]string{
+			"10 VTI 2024-01-10 cost $2000.00 proceeds $2500.00 gain $500.00 long true",
+			"5 VTI 2024-06-01 cost $1100.00 proceeds $1250.00 gain $150.00 long false",
+		})
+}
+
+func TestLotsLIFO(t *testing.T) {
+	want := []string{
+		"10 VTI 2024-06-01 cost $2200.00 proceeds $2500.00 gain $300.00 long false",
+		"5 VTI 2024-01-10 cost $1000.00 proceeds $1250.00 gain $250.00 long true",
+	}
+	checkLots(t, purchases+sale, LOT_LIFO, []string{"assets:brokerage 5 VTI {$200.00} 2024-01-10"}, want)
+
+	// A tag on the posting does the same whatever the method
+	tagged := strings.Replace(sale, "@ $250.00", "@ $250.00  ; lot: lifo", 1)
+	checkLots(t, purchases+tagged, LOT_FIFO, []string{"assets:brokerage 5 VTI {$200.00} 2024-01-10"}, want)
+}
+
+// A sale naming its lot only takes from that one
+func TestLotsSpecific(t *testing.T) {
+	checkLots(t, purchases+`2025-03-01 Sell
+    assets:brokerage       -5 VTI {$220.00} @ $250.00
+    assets:cash            $1,250.00
+`, LOT_FIFO,
+		[]string{"assets:brokerage 10 VTI {$200.00} 2024-01-10", "assets:brokerage 5 VTI {$220.00} 2024-06-01"},
+		[]string{"5 VTI 2024-06-01 cost $1100.00 proceeds $1250.00 gain $150.00 long false"})
+}
+
+// Shares moved without a price keep the cost and date of their lots, nothing is realized
+func TestLotsMoved(t *testing.T) {
+	checkLots(t, purchases+`2025-03-01 Transfer
+    assets:brokerage       -15 VTI
+    assets:retirement      15 VTI
+`, LOT_FIFO,
+		[]string{
+			"assets:brokerage 5 VTI {$220.00} 2024-06-01",
+			"assets:retirement 10 VTI {$200.00} 2024-01-10",
+			"assets:retirement 5 VTI {$220.00} 2024-06-01",
+		}, nil)
+}
+
+func TestLotsOversold(t *testing.T) {
+	_, _, err := trackJournal(t, purchases+`2025-03-01 Sell
+    assets:brokerage       -25 VTI @ $250.00
+    assets:cash            $6,250.00
+`, LOT_FIFO)
+	if err == nil || !strings.Contains(err.Error(), "can not sell 25 VTI from assets:brokerage, its lots only hold 20") {
+		t.Errorf("got %v, want an error about selling more than the lots hold", err)
+	}
+}
+
+// Loading works the lots out with the lot method of the config
+func TestLotsLoaded(t *testing.T) {
+	interpreter, err := loadText(t, purchases+sale)
+	if err != nil {
+		t.Fatalf("loading failed: %v", err)
+	}
+	if gains := interpreter.GetHoldings().Gains; len(gains) != 2 || gains[0].Gain.String() != "$500.00" {
+		t.Errorf("got gains %v, want the FIFO gains", gains)
+	}
+	report := interpreter.GenerateGainsReport(ReportOptions{})
+	for _, section := range []string{"REALIZED, SHORT TERM", "REALIZED, LONG TERM", "UNREALIZED"} {
+		if !strings.Contains(report, section) {
+			t.Errorf("the gains report has no %s section:\n%s", section, report)
+		}
+	}
+}
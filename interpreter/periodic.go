@@ -0,0 +1,54 @@
+package Interpreter
+
+import (
+	AST "gledger/ast"
+	"sort"
+	"time"
+)
+
+func (interpreter *Interpreter) GetPeriodicTransactions() []*AST.PeriodicTransaction {
+	return interpreter.periodic
+}
+
+/**
+ * Turn the periodic transactions into one transaction per occurrence from
+ * from (inclusive) to to (exclusive), ordered by date. They only live in
+ * memory, nothing here ends up in the journal.
+ */
+func (interpreter *Interpreter) ExpandPeriodic(from, to time.Time) []*AST.Transaction {
+	var transactions []*AST.Transaction
+	for _, periodic := range interpreter.periodic {
+		for _, date := range periodic.Period.Occurrences(from, to) {
+			occurrence := *periodic.Transaction
+			occurrence.Date = date
+			occurrence.Postings = append([]AST.Posting{}, periodic.Transaction.Postings...)
+			transactions = append(transactions, &occurrence)
+		}
+	}
+
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Date.Before(transactions[j].Date)
+	})
+	return transactions
+}
+
+/**
+ * What the periodic transactions say will happen after the last recorded
+ * transaction, up to and including the forecast date.
+ */
+func (interpreter *Interpreter) forecast(until time.Time) []*AST.Transaction {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var latest time.Time
+	for _, transaction := range interpreter.transactions {
+		if transaction.Date.After(latest) {
+			latest = transaction.Date
+		}
+	}
+	if !latest.IsZero() {
+		from = latest.AddDate(0, 0, 1)
+	}
+
+	return interpreter.ExpandPeriodic(from, until.AddDate(0, 0, 1))
+}
@@ -0,0 +1,130 @@
+package Interpreter
+
+import (
+	"fmt"
+	AST "gledger/ast"
+	"gledger/decimal"
+	Parser "gledger/parser"
+	"gledger/utils"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+)
+
+/**
+ * PriceHistory keeps every known price per commodity, oldest first.
+ * Prices come from P directives, the prices file in the config and the
+ * costs (@ / @@) written on postings.
+ */
+type PriceHistory map[string][]AST.MarketPrice
+
+// Goes after the prices of the same day or earlier, so prices mostly come in at the end
+func (history PriceHistory) Add(price AST.MarketPrice) {
+	prices := history[price.Commodity]
+	at := sort.Search(len(prices), func(i int) bool {
+		return prices[i].Date.After(price.Date)
+	})
+	history[price.Commodity] = slices.Insert(prices, at, price)
+}
+
+// The latest price of one unit of commodity in currency on or before date
+func (history PriceHistory) Latest(commodity, currency string, date time.Time) (AST.Amount, bool) {
+	prices := history[commodity]
+	for i := len(prices) - 1; i >= 0; i-- {
+		if prices[i].Price.Commodity == currency && !prices[i].Date.After(date) {
+			return prices[i].Price, true
+		}
+	}
+	return AST.Amount{}, false
+}
+
+// Costs on postings are prices too: 100 EUR @ $1.09 says a euro was worth $1.09 that day
+func (history PriceHistory) addCosts(transactions []*AST.Transaction) {
+	for _, transaction := range transactions {
+		for _, posting := range transaction.Postings {
+			if posting.Amount.Value.IsZero() {
+				continue
+			}
+
+			if posting.Price == nil {
+				if posting.Lot != nil {
+					history.Add(AST.MarketPrice{Date: transaction.Date, Commodity: posting.Amount.Commodity, Price: posting.Lot.Cost})
+				}
+				continue
+			}
+
+			unit := *posting.Price
+			if posting.TotalPrice {
+				total := posting.Price.Value
+				unit.Value = total.Div(posting.Amount.Value.Abs(), decimal.MaxScale).Normalize()
+				if unit.Value.Scale() < total.Scale() {
+					unit.Value = unit.Value.Rescale(total.Scale())
+				}
+			}
+
+			history.Add(AST.MarketPrice{Date: transaction.Date, Commodity: posting.Amount.Commodity, Price: unit})
+		}
+	}
+}
+
+// The separate prices file from the config, only its P directives are used
+func (interpreter *Interpreter) loadPricesFile(dataFile string) error {
+	filename := utils.ExpandHome(interpreter.config.PricesFile)
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(filepath.Dir(dataFile), filename)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("Error reading prices file: %v", err)
+	}
+
+	journal, err := Parser.ParseJournal(string(data), Parser.Options{File: filename, DateFormat: interpreter.config.DateFormat})
+	if err != nil {
+		return err
+	}
+
+	for _, item := range journal.Items {
+		if item.Kind == AST.ITEM_DIRECTIVE && item.Directive.Price != nil {
+			interpreter.prices.Add(*item.Directive.Price)
+		}
+	}
+
+	return nil
+}
+
+/**
+ * Convert every commodity of the balance into the configured currency with
+ * the latest price on or before date. Commodities without a price stay as
+ * they are.
+ */
+func (interpreter *Interpreter) marketValue(balance AST.Balance, date time.Time) AST.Balance {
+	currency := interpreter.config.Currency
+	valued := AST.Balance{}
+
+	for _, amount := range balance {
+		if amount.Commodity == currency {
+			valued.Add(amount)
+			continue
+		}
+
+		price, found := interpreter.prices.Latest(amount.Commodity, currency, date)
+		if !found {
+			valued.Add(amount)
+			continue
+		}
+
+		// Shown as precisely as the price was written
+		converted := price
+		converted.Value = amount.Value.Mul(price.Value).Round(price.Value.Scale())
+		valued.Add(converted)
+	}
+
+	return valued
+}
+
+func (interpreter *Interpreter) GetPrices() PriceHistory {
+	return interpreter.prices
+}
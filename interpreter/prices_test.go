@@ -0,0 +1,36 @@
+package Interpreter
+
+import (
+	AST "gledger/ast"
+	"gledger/decimal"
+	"testing"
+	"time"
+)
+
+// Prices end up in date order whatever order they come in, those of one day in the order they came
+func TestPriceHistoryAdd(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, time.January, d, 0, 0, 0, 0, time.UTC) }
+	price := func(d int, value string) AST.MarketPrice {
+		return AST.MarketPrice{Date: day(d), Commodity: "EUR", Price: AST.Amount{Value: decimal.MustParse(value), Commodity: "$"}}
+	}
+
+	history := PriceHistory{}
+	for _, added := range []AST.MarketPrice{price(10, "1.10"), price(2, "1.02"), price(20, "1.20"), price(10, "1.11"), price(1, "1.01")} {
+		history.Add(added)
+	}
+
+	want := []string{"1.01", "1.02", "1.10", "1.11", "1.20"}
+	prices := history["EUR"]
+	if len(prices) != len(want) {
+		t.Fatalf("got %d prices, want %d", len(prices), len(want))
+	}
+	for i, value := range want {
+		if got := prices[i].Price.Value.String(); got != value {
+			t.Errorf("price %d is %s, want %s", i, got, value)
+		}
+	}
+
+	if latest, found := history.Latest("EUR", "$", day(15)); !found || latest.Value.String() != "1.11" {
+		t.Errorf("latest price on the 15th is %v, want the last one of the 10th, 1.11", latest.Value)
+	}
+}
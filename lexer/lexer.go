@@ -3,46 +3,82 @@ package lexer
 import (
 	AST "gledger/ast"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
+/**
+ * The lexer reads runes, so accounts and descriptions can be in any
+ * language. Positions are byte offsets in the input, columns are counted in
+ * characters like an editor does.
+ */
 type Lexer struct {
 	input      string
-	position   int
+	position   int // byte offset
 	line       int
-	column     int
+	firstLine  int // of the input, it can be a part of a bigger file
+	column     int // in characters
 	lastColumn int
+
+	// Posting lines are INDENT ACCOUNT AMOUNT, whatever follows the account is the amount
+	inPosting    bool
+	expectAmount bool
+	expectLot    bool // {cost} and [date] can follow the amount of a posting
+
+	// Directive lines are DIRECTIVE STRING, the argument is the rest of the line
+	expectArgument bool
+
+	// Transaction lines are DATE [STATUS] STRING, postings are INDENT [STATUS] ACCOUNT ...
+	expectStatus      bool
+	expectDescription bool
+	expectAccount     bool
 }
 
 func CreateLexer(input string) *Lexer {
+	return CreateLexerAt(input, 1)
+}
+
+// A lexer for a part of a file starting at line, so the tokens have the lines of the file
+func CreateLexerAt(input string, line int) *Lexer {
 	return &Lexer{
 		input:      input,
 		position:   0,
-		line:       1,
+		line:       line,
+		firstLine:  line,
 		column:     0,
 		lastColumn: 0,
 	}
 }
 
+// Start again on input like a new lexer, for a parser that reads a file in parts
+func (lexer *Lexer) Reset(input string, line int) {
+	*lexer = Lexer{input: input, line: line, firstLine: line}
+}
+
 /**
  * Help the lexer peek what is in front of it without moving the cursor
  */
-func (lexer *Lexer) peek() byte {
+func (lexer *Lexer) peek() rune {
 	if lexer.position >= len(lexer.input) {
 		return 0 // EOF
 	}
-	return lexer.input[lexer.position]
+	if character := lexer.input[lexer.position]; character < utf8.RuneSelf {
+		return rune(character)
+	}
+	character, _ := utf8.DecodeRuneInString(lexer.input[lexer.position:])
+	return character
 }
 
 /**
  * Advance the lexer by one character and update line and column numbers
  */
-func (lexer *Lexer) advance() byte {
+func (lexer *Lexer) advance() rune {
 	if lexer.position >= len(lexer.input) {
 		return 0 // EOF
 	}
 
-	character := lexer.input[lexer.position]
-	lexer.position++
+	character, size := utf8.DecodeRuneInString(lexer.input[lexer.position:])
+	lexer.position += size
 	lexer.column++
 
 	/**
@@ -56,19 +92,62 @@ func (lexer *Lexer) advance() byte {
 	return character
 }
 
+// The \r of a Windows line ending belongs to the newline, it is never part of a token
+func (lexer *Lexer) atLineEnd() bool {
+	switch lexer.peek() {
+	case '\n', 0:
+		return true
+	case '\r':
+		return strings.HasPrefix(lexer.input[lexer.position+1:], "\n")
+	}
+	return false
+}
+
 func (lexer *Lexer) skipWhitespace() {
 	for lexer.peek() == ' ' || lexer.peek() == '\t' {
 		lexer.advance()
 	}
 }
 
-func (lexer *Lexer) NextToken() AST.Token {
-	lexer.lastColumn = lexer.column
+// Original text between two offsets, used to keep the exact source of every item
+func (lexer *Lexer) Source(start, end int) string {
+	return lexer.input[start:end]
+}
+
+// Text of line n, counted from 1, without its newline. Used to show where errors are
+func (lexer *Lexer) SourceLine(n int) string {
+	start := 0
+	for line := lexer.firstLine; line < n; line++ {
+		next := strings.IndexByte(lexer.input[start:], '\n')
+		if next < 0 {
+			return ""
+		}
+		start += next + 1
+	}
+
+	end := strings.IndexByte(lexer.input[start:], '\n')
+	if end < 0 {
+		return strings.TrimSuffix(lexer.input[start:], "\r")
+	}
+	return strings.TrimSuffix(lexer.input[start:start+end], "\r")
+}
 
+func (lexer *Lexer) NextToken() AST.Token {
 	if lexer.column > 0 {
 		lexer.skipWhitespace()
 	}
 
+	// Tokens start after the whitespace, errors point at them and not at the space before
+	lexer.lastColumn = lexer.column
+
+	start := lexer.position
+	token := lexer.scanToken()
+	token.Offset = start
+
+	return token
+}
+
+func (lexer *Lexer) scanToken() AST.Token {
 	// End of file
 	if lexer.position >= len(lexer.input) {
 		return AST.Token{Type: AST.TOKEN_EOF, Value: "", Line: lexer.line, Column: lexer.column}
@@ -76,38 +155,183 @@ func (lexer *Lexer) NextToken() AST.Token {
 
 	character := lexer.peek()
 
+	// The status marker can only be the first thing after the date or the indentation
+	expectStatus := lexer.expectStatus
+	lexer.expectStatus = false
+
+	if character == '\r' && lexer.atLineEnd() {
+		lexer.advance()
+		character = '\n'
+	}
+
 	if character == '\n' {
+		lexer.inPosting = false
+		lexer.expectAmount = false
+		lexer.expectLot = false
+		lexer.expectArgument = false
+		lexer.expectStatus = false
+		lexer.expectDescription = false
+		lexer.expectAccount = false
 		character = lexer.advance()
 		return AST.Token{Type: AST.TOKEN_NEWLINE, Value: "\n", Line: lexer.line - 1, Column: lexer.lastColumn}
 	}
 
 	// Comments
 	if character == ';' {
-		var comment strings.Builder
-		for lexer.peek() != '\n' && lexer.peek() != 0 {
-			comment.WriteString(string(lexer.advance()))
+		start := lexer.position
+		for !lexer.atLineEnd() {
+			lexer.advance()
 		}
-		return AST.Token{Type: AST.TOKEN_COMMENT, Value: comment.String(), Line: lexer.line, Column: lexer.lastColumn}
+		return AST.Token{Type: AST.TOKEN_COMMENT, Value: lexer.input[start:lexer.position], Line: lexer.line, Column: lexer.lastColumn}
 	}
 
 	// Identation
 	if lexer.column == 0 && (character == ' ' || character == '\t') {
-		indent := ""
+		start := lexer.position
 		for lexer.peek() == ' ' || lexer.peek() == '\t' {
-			indent += string(lexer.advance())
+			lexer.advance()
 		}
+		indent := lexer.input[start:lexer.position]
 
 		if len(indent) >= 2 {
+			lexer.inPosting = true
+			lexer.expectStatus = true
+			lexer.expectAccount = true
 			return AST.Token{Type: AST.TOKEN_INDENT, Value: indent, Line: lexer.line, Column: 0}
 		}
 	}
 
+	// Periodic transactions: ~ PERIOD  DESCRIPTION, the rest of the line is read as the description
+	if lexer.column == 0 && character == '~' {
+		lexer.advance()
+		lexer.expectDescription = true
+		return AST.Token{Type: AST.TOKEN_TILDE, Value: "~", Line: lexer.line, Column: 0}
+	}
+
+	// Automated transactions: = QUERY, the rest of the line is read as the query
+	if lexer.column == 0 && character == '=' {
+		lexer.advance()
+		lexer.expectDescription = true
+		return AST.Token{Type: AST.TOKEN_AUTOMATED, Value: "=", Line: lexer.line, Column: 0}
+	}
+
+	// Directives: a keyword at the very start of the line, other words there are left to the parser to reject
+	if lexer.column == 0 && isLetter(character) {
+		if keyword := lexer.directiveKeyword(); keyword != "" {
+			for range keyword {
+				lexer.advance()
+			}
+			lexer.expectArgument = true
+			return AST.Token{Type: AST.TOKEN_DIRECTIVE, Value: keyword, Line: lexer.line, Column: 0}
+		}
+	}
+
+	if expectStatus && (character == '*' || character == '!') {
+		lexer.advance()
+		return AST.Token{Type: AST.TOKEN_STATUS, Value: string(character), Line: lexer.line, Column: lexer.lastColumn}
+	}
+
+	// The description is everything up to the end of the line or a comment
+	if lexer.expectDescription {
+		lexer.expectDescription = false
+		return AST.Token{Type: AST.TOKEN_STRING, Value: lexer.readRestOfLine(), Line: lexer.line, Column: lexer.lastColumn}
+	}
+
+	if lexer.expectArgument {
+		lexer.expectArgument = false
+		return AST.Token{Type: AST.TOKEN_STRING, Value: lexer.readRestOfLine(), Line: lexer.line, Column: lexer.lastColumn}
+	}
+
+	if lexer.expectAmount {
+		lexer.expectAmount = false
+		if amount := lexer.readAmount(); amount != "" {
+			lexer.expectLot = true
+			return AST.Token{Type: AST.TOKEN_AMOUNT, Value: amount, Line: lexer.line, Column: lexer.lastColumn}
+		}
+	}
+
+	// Virtual accounts keep their brackets, the parser tells the kinds apart: (budget:dining) [owed:alice]
+	if lexer.expectAccount && (character == '(' || character == '[') {
+		closing := ')'
+		if character == '[' {
+			closing = ']'
+		}
+
+		lexer.expectAccount = false
+		start := lexer.position
+		for lexer.peek() != closing && lexer.peek() != '\n' && lexer.peek() != 0 {
+			lexer.advance()
+		}
+		if lexer.peek() != closing {
+			return AST.Token{Type: AST.TOKEN_ERROR, Value: lexer.input[start:lexer.position], Line: lexer.line, Column: lexer.lastColumn}
+		}
+		lexer.advance()
+		lexer.expectAmount = true
+		return AST.Token{Type: AST.TOKEN_ACCOUNT, Value: lexer.input[start:lexer.position], Line: lexer.line, Column: lexer.lastColumn}
+	}
+
+	// Lot annotations, the value is what is between the brackets
+	if lexer.expectLot && (character == '{' || character == '[') {
+		closing, tokenType := '}', AST.TOKEN_LOT_COST
+		if character == '[' {
+			closing, tokenType = ']', AST.TOKEN_LOT_DATE
+		}
+
+		lexer.advance()
+		start := lexer.position
+		for lexer.peek() != closing && lexer.peek() != '\n' && lexer.peek() != 0 {
+			lexer.advance()
+		}
+		if lexer.peek() != closing {
+			return AST.Token{Type: AST.TOKEN_ERROR, Value: string(character), Line: lexer.line, Column: lexer.lastColumn}
+		}
+		value := strings.TrimSpace(lexer.input[start:lexer.position])
+		lexer.advance()
+
+		return AST.Token{Type: tokenType, Value: value, Line: lexer.line, Column: lexer.lastColumn}
+	}
+
+	// Cost, @ per unit or @@ in total, another amount follows
+	if lexer.inPosting && character == '@' {
+		lexer.expectLot = false
+		start := lexer.position
+		lexer.advance()
+		if lexer.peek() == '@' {
+			lexer.advance()
+		}
+		lexer.expectAmount = true
+		return AST.Token{Type: AST.TOKEN_AT, Value: lexer.input[start:lexer.position], Line: lexer.line, Column: lexer.lastColumn}
+	}
+
+	// Balance assertion, another amount follows
+	if lexer.inPosting && character == '=' {
+		lexer.advance()
+		lexer.expectAmount = true
+		return AST.Token{Type: AST.TOKEN_EQUALS, Value: "=", Line: lexer.line, Column: lexer.lastColumn}
+	}
+
+	// A date at the start of the line begins a transaction: 2025-01-15, 2025/01/15, 15.01.2025 or 01/15
+	if isDigit(character) && lexer.lastColumn == 0 {
+		start := lexer.position
+		lexer.readDate()
+		lexer.expectStatus = true
+		lexer.expectDescription = true
+
+		// The effective date stays part of the token: 2025-01-30=2025-02-02
+		if lexer.peek() == '=' {
+			lexer.advance()
+			lexer.readDate()
+		}
+		return AST.Token{Type: AST.TOKEN_DATE, Value: lexer.input[start:lexer.position], Line: lexer.line, Column: lexer.lastColumn}
+	}
+
 	// Digits
 	if isDigit(character) {
-		date := "" // set as empty string for now
+		start := lexer.position
 		for isDigit(lexer.peek()) || lexer.peek() == '-' {
-			date += string(lexer.advance())
+			lexer.advance()
 		}
+		date := lexer.input[start:lexer.position]
 
 		// Pretty lame check but it should work for now, we will improve it later
 		if len(date) == 10 && date[4] == '-' && date[7] == '-' {
@@ -120,37 +344,45 @@ func (lexer *Lexer) NextToken() AST.Token {
 
 	// maybe is amount ?
 	if character == '$' || character == '-' || isDigit(character) {
-		amount := ""
+		start := lexer.position
 
 		// Could be negative ?
 		if character == '-' {
-			amount += string(lexer.advance())
+			lexer.advance()
 		}
 
 		// Currency symbol ?
 		if lexer.peek() == '$' {
-			amount += string(lexer.advance())
+			lexer.advance()
 		}
 
 		// Digits and decimal point
 		for isDigit(lexer.peek()) || lexer.peek() == '.' {
-			amount += string(lexer.advance())
+			lexer.advance()
 		}
 
-		if len(amount) > 0 {
-			return AST.Token{Type: AST.TOKEN_AMOUNT, Value: amount, Line: lexer.line, Column: lexer.lastColumn}
+		if lexer.position > start {
+			return AST.Token{Type: AST.TOKEN_AMOUNT, Value: lexer.input[start:lexer.position], Line: lexer.line, Column: lexer.lastColumn}
 		}
 	}
 
 	// accounts
 	if isLetter(character) {
-		account := ""
-
-		for isLetter(lexer.peek()) || lexer.peek() == ':' || lexer.peek() == '_' || isDigit(lexer.peek()) {
-			account += string(lexer.advance())
+		var account string
+
+		if lexer.expectAccount {
+			account = lexer.readPostingAccount()
+		} else {
+			start := lexer.position
+			for isAccountCharacter(lexer.peek()) {
+				lexer.advance()
+			}
+			account = lexer.input[start:lexer.position]
 		}
 
 		if strings.Contains(account, ":") {
+			lexer.expectAccount = false
+			lexer.expectAmount = lexer.inPosting
 			return AST.Token{Type: AST.TOKEN_ACCOUNT, Value: account, Line: lexer.line, Column: lexer.lastColumn}
 		}
 
@@ -160,7 +392,7 @@ func (lexer *Lexer) NextToken() AST.Token {
 	// random things ...
 
 	if character != '\n' && character != 0 {
-		value := ""
+		start := lexer.position
 		for lexer.peek() != '\n' && lexer.peek() != 0 && lexer.peek() != '$' {
 			if lexer.peek() == ' ' {
 				nextChar := lexer.position + 1
@@ -171,11 +403,10 @@ func (lexer *Lexer) NextToken() AST.Token {
 					}
 				}
 			}
-			value += string(lexer.advance())
-
+			lexer.advance()
 		}
 
-		value = strings.TrimSpace(value) // clean up
+		value := strings.TrimSpace(lexer.input[start:lexer.position]) // clean up
 		if len(value) > 0 {
 			return AST.Token{Type: AST.TOKEN_STRING, Value: value, Line: lexer.line, Column: lexer.lastColumn}
 		}
@@ -185,12 +416,91 @@ func (lexer *Lexer) NextToken() AST.Token {
 	return AST.Token{Type: AST.TOKEN_ERROR, Value: string(character), Line: lexer.line, Column: lexer.column}
 }
 
+/**
+ * Read everything up to the end of the line, a comment, a lot, a cost or an assertion as one amount,
+ * the commodity can be in front (€100), behind (10 AAPL) or quoted ("VANGUARD 500").
+ * utils.ParseAmount makes sense of it.
+ */
+func (lexer *Lexer) readAmount() string {
+	start := lexer.position
+	quoted := false
+
+	for !lexer.atLineEnd() {
+		if !quoted && strings.ContainsRune(";=@{[", lexer.peek()) {
+			break
+		}
+		if lexer.peek() == '"' {
+			quoted = !quoted
+		}
+		lexer.advance()
+	}
+
+	return strings.TrimRight(lexer.input[start:lexer.position], " \t")
+}
+
+// Digits and the separators dates are written with, the parser checks the format
+func (lexer *Lexer) readDate() {
+	for isDigit(lexer.peek()) || lexer.peek() == '-' || lexer.peek() == '/' || lexer.peek() == '.' {
+		lexer.advance()
+	}
+}
+
+// Descriptions and directive arguments go up to the end of the line or a comment
+func (lexer *Lexer) readRestOfLine() string {
+	start := lexer.position
+	for !lexer.atLineEnd() && lexer.peek() != ';' {
+		lexer.advance()
+	}
+	return strings.TrimSpace(lexer.input[start:lexer.position])
+}
+
+/**
+ * The account of a posting can contain single spaces, it ends at two spaces, a tab,
+ * a comment or the end of the line: assets:Bank of America:checking  $10.00
+ */
+func (lexer *Lexer) readPostingAccount() string {
+	start := lexer.position
+
+	for !lexer.atLineEnd() && lexer.peek() != '\t' && lexer.peek() != ';' {
+		if lexer.peek() == ' ' && lexer.position+1 < len(lexer.input) && strings.IndexByte(" \t", lexer.input[lexer.position+1]) >= 0 {
+			break
+		}
+		lexer.advance()
+	}
+
+	return strings.TrimRight(lexer.input[start:lexer.position], " ")
+}
+
 /** Utils */
 
-func isDigit(character byte) bool {
+// Only ASCII digits, they make up dates and amounts
+func isDigit(character rune) bool {
 	return character >= '0' && character <= '9'
 }
 
-func isLetter(character byte) bool {
-	return (character >= 'a' && character <= 'z') || (character >= 'A' && character <= 'Z')
+// The directives the parser knows, anything else at the start of a line is a mistake
+var directives = []string{"account", "include", "P", "Y", "year"}
+
+// The directive starting at the current position, a whole word followed by a space or the end of the line
+func (lexer *Lexer) directiveKeyword() string {
+	rest := lexer.input[lexer.position:]
+	for _, keyword := range directives {
+		if !strings.HasPrefix(rest, keyword) {
+			continue
+		}
+		switch next := rest[len(keyword):]; {
+		case next == "", next[0] == ' ', next[0] == '\t', next[0] == '\n', next[0] == '\r', next[0] == ';':
+			return keyword
+		}
+	}
+	return ""
+}
+
+func isLetter(character rune) bool {
+	return unicode.IsLetter(character)
+}
+
+// Letters and digits of any script, combining accents included: dépenses:café, расходи:храна
+func isAccountCharacter(character rune) bool {
+	return isLetter(character) || unicode.IsDigit(character) || unicode.IsMark(character) || character == ':' || character == '_'
 }
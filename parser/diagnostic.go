@@ -0,0 +1,104 @@
+package Parser
+
+import (
+	"fmt"
+	AST "gledger/ast"
+	"strings"
+)
+
+/**
+ * Diagnostic is one problem in the input, shown the way compilers do with
+ * the line it is on and a caret under the spot:
+ *
+ *	error: Expected amount, got "abc"
+ *	  --> ledger.txt:12:29
+ *	   |
+ *	12 |     expenses:food           abc
+ *	   |                             ^
+ */
+type Diagnostic struct {
+	File    string
+	Line    int
+	Column  int // counted from 1
+	Message string
+	Source  string // the whole line, without its newline
+}
+
+func (diagnostic *Diagnostic) Error() string {
+	location := fmt.Sprintf("line %d:%d", diagnostic.Line, diagnostic.Column)
+	if diagnostic.File != "" {
+		location = fmt.Sprintf("%s:%d:%d", diagnostic.File, diagnostic.Line, diagnostic.Column)
+	}
+
+	number := fmt.Sprint(diagnostic.Line)
+	gutter := strings.Repeat(" ", len(number))
+
+	// Columns are in characters. Tabs are kept so the caret lines up with the source however they are displayed
+	var padding strings.Builder
+	for i, character := range []rune(diagnostic.Source) {
+		if i >= diagnostic.Column-1 {
+			break
+		}
+		if character == '\t' {
+			padding.WriteRune('\t')
+		} else {
+			padding.WriteRune(' ')
+		}
+	}
+
+	var rendered strings.Builder
+	rendered.WriteString(fmt.Sprintf("error: %s\n", diagnostic.Message))
+	rendered.WriteString(fmt.Sprintf("%s--> %s\n", gutter, location))
+	rendered.WriteString(fmt.Sprintf("%s |\n", gutter))
+	rendered.WriteString(fmt.Sprintf("%s | %s\n", number, diagnostic.Source))
+	rendered.WriteString(fmt.Sprintf("%s | %s^", gutter, padding.String()))
+	return rendered.String()
+}
+
+// Diagnostics are all the problems found in one file, in the order of the input
+type Diagnostics []*Diagnostic
+
+func (diagnostics Diagnostics) Error() string {
+	var rendered []string
+	for _, diagnostic := range diagnostics {
+		rendered = append(rendered, diagnostic.Error())
+	}
+
+	summary := "1 error"
+	if len(diagnostics) != 1 {
+		summary = fmt.Sprintf("%d errors", len(diagnostics))
+	}
+	return strings.Join(rendered, "\n\n") + "\n\n" + summary
+}
+
+// A diagnostic at line and column (counted from 0, like the tokens) of the input
+func (parser *Parser) diagnostic(line, column int, format string, args ...any) *Diagnostic {
+	return &Diagnostic{
+		File:    parser.options.File,
+		Line:    line,
+		Column:  column + 1,
+		Message: fmt.Sprintf(format, args...),
+		Source:  parser.lexer.SourceLine(line),
+	}
+}
+
+func (parser *Parser) errorAt(token AST.Token, format string, args ...any) *Diagnostic {
+	return parser.diagnostic(token.Line, token.Column, format, args...)
+}
+
+func (parser *Parser) errorAtPosition(position AST.Position, format string, args ...any) *Diagnostic {
+	return parser.diagnostic(position.Line, position.Column, format, args...)
+}
+
+// How a token is named in errors
+func describe(token AST.Token) string {
+	switch token.Type {
+	case AST.TOKEN_NEWLINE:
+		return "end of line"
+	case AST.TOKEN_EOF:
+		return "end of file"
+	case AST.TOKEN_INDENT:
+		return "indentation"
+	}
+	return fmt.Sprintf("%q", token.Value)
+}
@@ -1,10 +1,14 @@
 package Parser
 
 import (
+	"errors"
 	"fmt"
 	AST "gledger/ast"
+	"gledger/decimal"
 	"gledger/lexer"
 	"gledger/utils"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,61 +16,337 @@ type Parser struct {
 	lexer   *lexer.Lexer
 	current AST.Token // current token
 	peek    AST.Token // next token
+	options Options
+	year    int // for dates written without one, set with the Y directive
+
+	postings []AST.Posting // of the transaction being read, reused from one to the next
 }
 
-func runParser(input string) *Parser {
-	lexer := lexer.CreateLexer(input)
-	parser := &Parser{lexer: lexer}
+// Options change how forgiving the parser is
+type Options struct {
+	Strict     bool                       // reject postings to accounts that were never declared
+	Accounts   map[string]AST.AccountType // account declarations, shared between included files
+	File       string                     // shown in the diagnostics
+	DateFormat string                     // Go layout of the configured date format, read next to the usual ones
+	Line       int                        // of the first line read, when the input is the rest of a file
+	Year       int                        // of dates without one until a Y directive, the current year when 0
+}
 
-	parser.nextToken()
-	parser.nextToken()
+func runParser(input string, options Options) *Parser {
+	if options.Accounts == nil {
+		options.Accounts = map[string]AST.AccountType{}
+	}
+
+	parser := &Parser{options: options, year: options.Year}
+	if parser.year == 0 {
+		parser.year = time.Now().Year()
+	}
+	parser.reset(input, max(options.Line, 1))
 
 	return parser
 }
 
+// Go on with input, which starts at line of the file. What the directives set is kept
+func (parser *Parser) reset(input string, line int) {
+	if parser.lexer == nil {
+		parser.lexer = lexer.CreateLexerAt(input, line)
+	} else {
+		parser.lexer.Reset(input, line)
+	}
+
+	parser.nextToken()
+	parser.nextToken()
+}
+
 func (parser *Parser) nextToken() {
 	parser.current = parser.peek
 	parser.peek = parser.lexer.NextToken()
 }
 
-func (parser *Parser) skipNewLines() {
-	for parser.current.Type == AST.TOKEN_NEWLINE {
-		parser.nextToken()
+/**
+ * Parse the whole input into a journal. Blank lines, comments and directives
+ * are kept as items next to the transactions, together with the original
+ * text of every item, so the file can be written back byte for byte.
+ *
+ * A broken item does not stop the parser, it goes on with the next dated
+ * line so every problem of the file is reported at once as Diagnostics.
+ */
+func (parser *Parser) Parse() (*AST.Journal, error) {
+	journal := &AST.Journal{}
+
+	diagnostics := parser.parseItems(func(item *AST.Item) {
+		journal.Items = append(journal.Items, item)
+	})
+	if len(diagnostics) > 0 {
+		return nil, diagnostics
 	}
+	return journal, nil
 }
 
-func (parser *Parser) Parse() ([]*AST.Transaction, error) {
-	var transactions []*AST.Transaction
+// Every item of the input goes to handle as soon as it is parsed, the broken ones are returned
+func (parser *Parser) parseItems(handle func(*AST.Item)) Diagnostics {
+	var diagnostics Diagnostics
+
+	for parser.current.Type != AST.TOKEN_EOF {
+		start := parser.current.Offset
+		item := &AST.Item{Line: parser.current.Line}
+		err := parser.parseItem(item)
+		if err != nil {
+			diagnostic, isDiagnostic := err.(*Diagnostic)
+			if !isDiagnostic {
+				diagnostic = parser.errorAt(parser.current, "%v", err)
+			}
+			diagnostics = append(diagnostics, diagnostic)
+			parser.skipItem(start)
+			continue
+		}
+
+		item.Text = parser.lexer.Source(start, parser.current.Offset)
+		handle(item)
+	}
+
+	return diagnostics
+}
+
+// One item, what it is depends on how its first line starts
+func (parser *Parser) parseItem(item *AST.Item) (err error) {
+	// Amounts too large to add up or multiply are reported on the first line of their item
+	first := parser.current
+	defer func() {
+		if errors.Is(err, decimal.ErrOverflow) {
+			err = parser.errorAt(first, "Amounts too large to work with: %v", err)
+		}
+	}()
+	defer decimal.Recover(&err)
+
+	switch {
+	case parser.current.Type == AST.TOKEN_NEWLINE:
+		item.Kind = AST.ITEM_BLANK
+		parser.nextToken()
+
+	case parser.current.Type == AST.TOKEN_INDENT && parser.peek.Type == AST.TOKEN_NEWLINE:
+		item.Kind = AST.ITEM_BLANK
+		parser.nextToken()
+		parser.nextToken()
+
+	case parser.current.Type == AST.TOKEN_COMMENT,
+		parser.current.Type == AST.TOKEN_INDENT && parser.peek.Type == AST.TOKEN_COMMENT:
+		item.Kind = AST.ITEM_COMMENT
+		if parser.current.Type == AST.TOKEN_INDENT {
+			parser.nextToken()
+		}
+		_, err = parser.parseEndOfLine()
+
+	case parser.current.Type == AST.TOKEN_TILDE:
+		item.Kind = AST.ITEM_PERIODIC
+		item.Periodic, err = parser.parsePeriodicTransaction()
+
+	case parser.current.Type == AST.TOKEN_AUTOMATED:
+		item.Kind = AST.ITEM_AUTOMATED
+		item.Automated, err = parser.parseAutomatedTransaction()
+
+	case parser.current.Type == AST.TOKEN_DIRECTIVE:
+		item.Kind = AST.ITEM_DIRECTIVE
+		item.Directive, err = parser.parseDirective()
+
+	default:
+		item.Kind = AST.ITEM_TRANSACTION
+		item.Transaction, err = parser.parserTransaction()
+	}
+
+	return err
+}
 
-	parser.skipNewLines()
+// Skip what is left of a broken item, up to the next line starting a new one
+func (parser *Parser) skipItem(start int) {
 	for parser.current.Type != AST.TOKEN_EOF {
-		t, err := parser.parserTransaction()
+		if parser.current.Offset > start && parser.current.Column == 0 {
+			switch parser.current.Type {
+			case AST.TOKEN_DATE, AST.TOKEN_TILDE, AST.TOKEN_AUTOMATED, AST.TOKEN_DIRECTIVE:
+				return
+			}
+		}
+		parser.nextToken()
+	}
+}
+
+/**
+ * Every line ends with an optional comment and a newline, or the end of
+ * the file for the last line. Returns the comment if there was one.
+ */
+func (parser *Parser) parseEndOfLine() (string, error) {
+	comment := ""
+	if parser.current.Type == AST.TOKEN_COMMENT {
+		comment = strings.TrimSpace(strings.TrimPrefix(parser.current.Value, ";"))
+		parser.nextToken()
+	}
+
+	switch parser.current.Type {
+	case AST.TOKEN_NEWLINE:
+		parser.nextToken()
+	case AST.TOKEN_EOF:
+	default:
+		return "", parser.errorAt(parser.current, "Expected end of line, got %s", describe(parser.current))
+	}
+
+	return comment, nil
+}
+
+// Dates in the configured format or one of the usual ones, 01/15 is in the year of the Y directive
+func (parser *Parser) parseDate(value string) (time.Time, error) {
+	return utils.ParseDate(value, parser.options.DateFormat, parser.year)
+}
+
+// Indented comment lines belong to the transaction or posting above them
+func (parser *Parser) isCommentLine() bool {
+	return parser.current.Type == AST.TOKEN_INDENT && parser.peek.Type == AST.TOKEN_COMMENT
+}
+
+func (parser *Parser) parseDirective() (*AST.Directive, error) {
+	directive := &AST.Directive{Name: parser.current.Value}
+	parser.nextToken()
+
+	argument := parser.current
+	if parser.current.Type == AST.TOKEN_STRING {
+		directive.Argument = parser.current.Value
+		parser.nextToken()
+	}
+
+	if _, err := parser.parseEndOfLine(); err != nil {
+		return nil, err
+	}
+
+	if err := parser.applyDirective(directive); err != nil {
+		return nil, parser.errorAt(argument, "%v", err)
+	}
+
+	if directive.Name == "P" {
+		price, err := parser.parsePriceDirective(directive.Argument)
 		if err != nil {
-			return nil, fmt.Errorf("Error parsing transaction at line %d: %v", parser.current.Line, err)
+			return nil, parser.errorAt(argument, "%v", err)
 		}
+		directive.Price = price
+	}
+
+	return directive, nil
+}
 
-		if t != nil {
-			transactions = append(transactions, t)
+// What a directive changes for the rest of the file
+func (parser *Parser) applyDirective(directive *AST.Directive) error {
+	switch directive.Name {
+	case "account":
+		return parser.declareAccount(directive.Argument)
+	case "Y", "year":
+		year, err := strconv.Atoi(directive.Argument)
+		if err != nil || year < 1 {
+			return fmt.Errorf("%s needs a year, got %q", directive.Name, directive.Argument)
 		}
+		parser.year = year
+	}
+	return nil
+}
+
+/**
+ * P 2025-01-15 AAPL $185.20
+ * P 2025-01-15 10:30:00 "VANGUARD 500" 412.10 USD
+ *
+ * The time is allowed for compatibility but only the date is used.
+ */
+func (parser *Parser) parsePriceDirective(argument string) (*AST.MarketPrice, error) {
+	fields := strings.Fields(argument)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("P needs a date, a commodity and a price")
+	}
+
+	date, err := parser.parseDate(fields[0])
+	if err != nil {
+		return nil, err
+	}
 
-		parser.skipNewLines()
+	rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(argument), fields[0]))
+	if strings.Count(fields[1], ":") >= 1 && fields[1][0] >= '0' && fields[1][0] <= '9' {
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, fields[1]))
+	}
 
+	// The commodity is either quoted or the next word
+	var commodity string
+	if strings.HasPrefix(rest, `"`) {
+		end := strings.Index(rest[1:], `"`)
+		if end < 0 {
+			return nil, fmt.Errorf("Unterminated commodity in P directive")
+		}
+		commodity, rest = rest[1:end+1], rest[end+2:]
+	} else {
+		word := strings.Fields(rest)[0]
+		commodity, rest = word, strings.TrimPrefix(rest, word)
 	}
-	return transactions, nil
+
+	price, err := utils.ParseAmount(rest)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid price in P directive: %v", err)
+	}
+
+	// $ in the commodity position means USD, like everywhere else
+	if parsed, err := utils.ParseAmount("1 " + AST.QuoteCommodity(commodity)); err == nil {
+		commodity = parsed.Commodity
+	}
+
+	return &AST.MarketPrice{Date: date, Commodity: commodity, Price: price}, nil
+}
+
+/**
+ * account expenses:food
+ * account assets:checking asset
+ *
+ * The type is optional and has to be the last word.
+ */
+func (parser *Parser) declareAccount(argument string) error {
+	fields := strings.Fields(argument)
+	if len(fields) == 0 {
+		return fmt.Errorf("account needs a name")
+	}
+
+	name, accountType := argument, AST.ACCOUNT_UNKNOWN
+	if len(fields) > 1 {
+		if parsed, err := AST.ParseAccountType(fields[len(fields)-1]); err == nil {
+			accountType = parsed
+			name = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(argument), fields[len(fields)-1]))
+		}
+	}
+
+	parser.options.Accounts[name] = accountType
+	return nil
 }
 
 func (parser *Parser) parserTransaction() (*AST.Transaction, error) {
 	if parser.current.Type != AST.TOKEN_DATE {
-		return nil, fmt.Errorf("Expected date at line %d, got %s", parser.current.Line, parser.current.Value)
+		// Lines starting at the left margin are transactions or directives, a posting there lost its indentation
+		return nil, parser.errorAt(parser.current, "Expected a date or a directive (account, include, P, Y), got %s", describe(parser.current))
 	}
+	header := parser.current
 
-	date, err := time.Parse("2006-01-02", parser.current.Value)
+	primary, secondary, hasEffective := strings.Cut(parser.current.Value, "=")
+	date, err := parser.parseDate(primary)
 	if err != nil {
-		return nil, fmt.Errorf("Invalid date format at line %d: %v", parser.current.Line, err)
+		return nil, parser.errorAt(header, "%v", err)
+	}
+
+	// An effective date without a year is in the year of the transaction
+	var effectiveDate time.Time
+	if hasEffective {
+		effectiveDate, err = utils.ParseDate(secondary, parser.options.DateFormat, date.Year())
+		if err != nil {
+			return nil, parser.errorAt(header, "%v", err)
+		}
 	}
 
 	parser.nextToken()
 
+	status, err := parser.parseStatus()
+	if err != nil {
+		return nil, err
+	}
+
 	description := ""
 
 	for parser.current.Type == AST.TOKEN_STRING {
@@ -78,78 +358,428 @@ func (parser *Parser) parserTransaction() (*AST.Transaction, error) {
 	}
 
 	if description == "" {
-		return nil, fmt.Errorf("Missing description at line %d", parser.current.Line)
+		return nil, parser.errorAt(parser.current, "Missing description, got %s", describe(parser.current))
 	}
 
-	if parser.current.Type != AST.TOKEN_NEWLINE {
-		return nil, fmt.Errorf("Expected newline after description at line %d", parser.current.Line)
+	if parser.current.Type != AST.TOKEN_NEWLINE && parser.current.Type != AST.TOKEN_COMMENT && parser.current.Type != AST.TOKEN_EOF {
+		return nil, parser.errorAt(parser.current, "Expected end of line after the description, got %s", describe(parser.current))
 	}
-	parser.nextToken()
 
-	postings := []AST.Posting{}
+	currentTransaction := &AST.Transaction{
+		Position:      AST.Position{Line: header.Line, Column: header.Column},
+		Date:          date,
+		EffectiveDate: effectiveDate,
+		Status:        status,
+		Description:   description,
+	}
+	if err := parser.parseTransactionBody(currentTransaction); err != nil {
+		return nil, err
+	}
 
-	for parser.current.Type == AST.TOKEN_INDENT {
-		posting, err := parser.parsePosting()
+	return currentTransaction, nil
+}
+
+// The comment ending the header line, then the postings and their comment lines
+func (parser *Parser) parsePostingLines() ([]string, []AST.Posting, error) {
+	var comments []string
+	if comment, _ := parser.parseEndOfLine(); comment != "" {
+		comments = append(comments, comment)
+	}
 
+	postings := parser.postings[:0]
+	defer func() { parser.postings = postings }()
+
+	for parser.current.Type == AST.TOKEN_INDENT && parser.peek.Type != AST.TOKEN_NEWLINE {
+		if parser.isCommentLine() {
+			parser.nextToken()
+			comment, err := parser.parseEndOfLine()
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(postings) == 0 {
+				comments = append(comments, comment)
+			} else {
+				postings[len(postings)-1].Comments = append(postings[len(postings)-1].Comments, comment)
+			}
+			continue
+		}
+
+		posting, err := parser.parsePosting()
 		if err != nil {
-			return nil, fmt.Errorf("Error parsing posting at line %d: %v", parser.current.Line, err)
+			return nil, nil, err
 		}
 		postings = append(postings, posting)
 	}
 
+	// The transaction gets a copy of the right size
+	return comments, append([]AST.Posting(nil), postings...), nil
+}
+
+/**
+ * The comment after the header line, then the postings with their
+ * comments. Amounts left out are inferred and the transaction has to
+ * balance.
+ */
+func (parser *Parser) parseTransactionBody(transaction *AST.Transaction) error {
+	comments, postings, err := parser.parsePostingLines()
+	if err != nil {
+		return err
+	}
+
 	if len(postings) < 2 {
-		return nil, fmt.Errorf("Transaction must have at least two posting at line %d", parser.current.Line)
+		return parser.errorAtPosition(transaction.Position, "Transaction must have at least two postings")
 	}
 
-	currentTransaction := &AST.Transaction{
-		Date:        date,
+	transaction.Postings = postings
+	transaction.Comments = comments
+	transaction.CollectTags()
+
+	// date: tags give a posting its own clearing date
+	for i := range transaction.Postings {
+		posting := &transaction.Postings[i]
+		if value, exists := posting.Tags["date"]; exists {
+			date, err := utils.ParseDate(value, parser.options.DateFormat, transaction.Date.Year())
+			if err != nil {
+				return parser.errorAtPosition(posting.Position, "%v", err)
+			}
+			posting.Date = date
+		}
+	}
+
+	if err := parser.checkAccounts(postings); err != nil {
+		return err
+	}
+
+	// The interpreter balances these once it knows the running balances
+	if transaction.HasBalanceAssignments() {
+		return nil
+	}
+
+	if err := transaction.InferElidedAmounts(); err != nil {
+		return parser.errorAtPosition(transaction.Position, "%v", err)
+	}
+
+	if !transaction.IsBalanced() {
+		return parser.errorAtPosition(transaction.Position, "Transaction is not balanced (sum: %s)", transaction.Imbalance())
+	}
+
+	return nil
+}
+
+// ~ PERIOD  DESCRIPTION followed by postings like a transaction
+func (parser *Parser) parsePeriodicTransaction() (*AST.PeriodicTransaction, error) {
+	header := parser.current
+	parser.nextToken()
+
+	if parser.current.Type != AST.TOKEN_STRING || parser.current.Value == "" {
+		return nil, parser.errorAt(header, "Missing period after ~")
+	}
+
+	// The description is separated from the period by two spaces or a tab
+	expression, description := parser.current.Value, ""
+	separator := strings.Index(expression, "  ")
+	if tab := strings.Index(expression, "\t"); tab >= 0 && (separator < 0 || tab < separator) {
+		separator = tab
+	}
+	if separator >= 0 {
+		expression, description = expression[:separator], strings.TrimSpace(expression[separator:])
+	}
+
+	period, err := AST.ParsePeriod(expression, parser.parseDate)
+	if err != nil {
+		return nil, parser.errorAt(parser.current, "Invalid period: %v", err)
+	}
+	parser.nextToken()
+
+	transaction := &AST.Transaction{
+		Position:    AST.Position{Line: header.Line, Column: header.Column},
+		Date:        period.Start,
 		Description: description,
-		Postings:    postings,
+	}
+	if err := parser.parseTransactionBody(transaction); err != nil {
+		return nil, err
 	}
 
-	if !currentTransaction.IsBalanced() {
-		return nil, fmt.Errorf("Transaction is not balanced at line %d (sum: %.2f)", parser.current.Line, currentTransaction.Balance())
+	for _, posting := range transaction.Postings {
+		if posting.Assertion != nil {
+			return nil, parser.errorAtPosition(posting.Position, "Balance assertions are not allowed in periodic transactions")
+		}
 	}
 
-	return currentTransaction, nil
+	return &AST.PeriodicTransaction{Period: period, Transaction: transaction}, nil
+}
+
+// In strict mode every account has to be declared before it is used
+func (parser *Parser) checkAccounts(postings []AST.Posting) error {
+	if !parser.options.Strict {
+		return nil
+	}
+	for _, posting := range postings {
+		if _, declared := parser.options.Accounts[posting.Account]; !declared {
+			return parser.errorAtPosition(posting.Position, "%v", utils.UnknownAccountError(posting.Account, parser.options.Accounts))
+		}
+	}
+	return nil
+}
+
+// = QUERY followed by template postings, they do not have to balance
+func (parser *Parser) parseAutomatedTransaction() (*AST.AutomatedTransaction, error) {
+	header := parser.current
+	parser.nextToken()
+
+	if parser.current.Type != AST.TOKEN_STRING || parser.current.Value == "" {
+		return nil, parser.errorAt(header, "Missing account or /pattern/ after =")
+	}
+	queryToken := parser.current
+	query := parser.current.Value
+	parser.nextToken()
+
+	comments, postings, err := parser.parsePostingLines()
+	if err != nil {
+		return nil, err
+	}
+	if len(postings) == 0 {
+		return nil, parser.errorAt(header, "Automated transaction without postings")
+	}
+
+	for _, posting := range postings {
+		if posting.Elided || posting.Assertion != nil || posting.Lot != nil {
+			return nil, parser.errorAtPosition(posting.Position, "Automated postings need a plain amount")
+		}
+	}
+
+	if err := parser.checkAccounts(postings); err != nil {
+		return nil, err
+	}
+
+	transaction := &AST.Transaction{Position: AST.Position{Line: header.Line, Column: header.Column}, Postings: postings, Comments: comments}
+	transaction.CollectTags()
+
+	automated, err := AST.NewAutomatedTransaction(query, transaction)
+	if err != nil {
+		return nil, parser.errorAt(queryToken, "%v", err)
+	}
+	return automated, nil
 }
 
 func (parser *Parser) parsePosting() (AST.Posting, error) {
 	if parser.current.Type != AST.TOKEN_INDENT {
-		return AST.Posting{}, fmt.Errorf("Expected indent at line %d, got %s", parser.current.Line, parser.current.Value)
+		return AST.Posting{}, parser.errorAt(parser.current, "Expected an indented posting, got %s", describe(parser.current))
 	}
-
 	parser.nextToken()
 
+	status, err := parser.parseStatus()
+	if err != nil {
+		return AST.Posting{}, err
+	}
+
 	if parser.current.Type != AST.TOKEN_ACCOUNT {
-		return AST.Posting{}, fmt.Errorf("Expected account at line %d, got %s", parser.current.Line, parser.current.Value)
+		return AST.Posting{}, parser.errorAt(parser.current, "Expected an account, got %s", describe(parser.current))
 	}
+	accountToken := parser.current
 
-	account := parser.current.Value
+	kind, account := AST.POSTING_REAL, parser.current.Value
+	if strings.HasPrefix(account, "(") && strings.HasSuffix(account, ")") {
+		kind, account = AST.POSTING_VIRTUAL, strings.TrimSpace(account[1:len(account)-1])
+	} else if strings.HasPrefix(account, "[") && strings.HasSuffix(account, "]") {
+		kind, account = AST.POSTING_BALANCED_VIRTUAL, strings.TrimSpace(account[1:len(account)-1])
+	}
+	if account == "" {
+		return AST.Posting{}, parser.errorAt(accountToken, "Missing account name")
+	}
 	parser.nextToken()
 
+	posting := AST.Posting{
+		Position: AST.Position{Line: accountToken.Line, Column: accountToken.Column},
+		Status:   status,
+		Kind:     kind,
+		Account:  account,
+	}
+
+	// Balance assignment: no amount, only the balance to reach
+	if parser.current.Type == AST.TOKEN_EQUALS {
+		assertion, err := parser.parseAssertion()
+		if err != nil {
+			return AST.Posting{}, err
+		}
+		posting.Assertion = assertion
+		posting.Assigned = true
+		return posting, parser.parsePostingEnd(&posting)
+	}
+
+	// No amount, it will be inferred from the other postings
+	if parser.current.Type == AST.TOKEN_NEWLINE || parser.current.Type == AST.TOKEN_COMMENT || parser.current.Type == AST.TOKEN_EOF {
+		if amountInAccount(account) {
+			return AST.Posting{}, parser.errorAt(accountToken, "The account %q looks like it contains the amount, separate them with two spaces or a tab", account)
+		}
+		posting.Elided = true
+		return posting, parser.parsePostingEnd(&posting)
+	}
+
 	if parser.current.Type != AST.TOKEN_AMOUNT {
-		return AST.Posting{}, fmt.Errorf("Expected amount at line %d, got %s", parser.current.Line, parser.current.Value)
+		return AST.Posting{}, parser.errorAt(parser.current, "Expected an amount, got %s", describe(parser.current))
 	}
 
 	amount, err := utils.ParseAmount(parser.current.Value)
 	if err != nil {
-		return AST.Posting{}, fmt.Errorf("Invalid amount format at line %d: %v", parser.current.Line, err)
+		return AST.Posting{}, parser.errorAt(parser.current, "Invalid amount: %v", err)
+	}
+
+	posting.Amount = amount
+	parser.nextToken()
+
+	if parser.current.Type == AST.TOKEN_LOT_COST {
+		if err := parser.parseLot(&posting); err != nil {
+			return AST.Posting{}, err
+		}
+	}
+
+	if parser.current.Type == AST.TOKEN_AT {
+		if err := parser.parseCost(&posting); err != nil {
+			return AST.Posting{}, err
+		}
+	}
+
+	if parser.current.Type == AST.TOKEN_EQUALS {
+		assertion, err := parser.parseAssertion()
+		if err != nil {
+			return AST.Posting{}, err
+		}
+		posting.Assertion = assertion
+	}
+
+	if parser.current.Type != AST.TOKEN_NEWLINE && parser.current.Type != AST.TOKEN_COMMENT && parser.current.Type != AST.TOKEN_EOF {
+		return AST.Posting{}, parser.errorAt(parser.current, "Expected end of line after the posting, got %s", describe(parser.current))
+	}
+
+	return posting, parser.parsePostingEnd(&posting)
+}
+
+/**
+ * Account names can contain single spaces, so with only one space before
+ * the amount it ends up in the name: expenses:food $5.00
+ */
+func amountInAccount(account string) bool {
+	for i, character := range account {
+		if character != ' ' {
+			continue
+		}
+		rest := account[i+1:]
+		if strings.ContainsAny(rest[:1], "=@{") {
+			return true
+		}
+		if amount, err := utils.ParseAmount(rest); err == nil && amount.Commodity != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// @ $1.09 or @@ $109 after the amount of a posting
+func (parser *Parser) parseCost(posting *AST.Posting) error {
+	posting.TotalPrice = parser.current.Value == "@@"
+	parser.nextToken()
+
+	if parser.current.Type != AST.TOKEN_AMOUNT {
+		return parser.errorAt(parser.current, "Expected a cost after @, got %s", describe(parser.current))
+	}
+
+	price, err := utils.ParseAmount(parser.current.Value)
+	if err != nil {
+		return parser.errorAt(parser.current, "Invalid cost: %v", err)
+	}
+	if price.Value.IsNegative() {
+		return parser.errorAt(parser.current, "Cost can not be negative")
+	}
+	if price.Commodity == posting.Amount.Commodity {
+		return parser.errorAt(parser.current, "Cost has to be in another commodity than the amount")
+	}
+	parser.nextToken()
+
+	posting.Price = &price
+	return nil
+}
+
+// {$220.00} [2024-03-01] after the amount of a posting, the date is optional
+func (parser *Parser) parseLot(posting *AST.Posting) error {
+	cost, err := utils.ParseAmount(parser.current.Value)
+	if err != nil {
+		return parser.errorAt(parser.current, "Invalid lot cost: %v", err)
+	}
+	if cost.Value.IsNegative() {
+		return parser.errorAt(parser.current, "Lot cost can not be negative")
+	}
+	if cost.Commodity == "" || cost.Commodity == posting.Amount.Commodity {
+		return parser.errorAt(parser.current, "Lot cost has to be in another commodity than the amount")
+	}
+	parser.nextToken()
+
+	posting.Lot = &AST.Lot{Cost: cost}
+
+	if parser.current.Type == AST.TOKEN_LOT_DATE {
+		date, err := parser.parseDate(parser.current.Value)
+		if err != nil {
+			return parser.errorAt(parser.current, "%v", err)
+		}
+		posting.Lot.Date = date
+		parser.nextToken()
 	}
 
+	return nil
+}
+
+// = $1,204.18 after the amount of a posting
+func (parser *Parser) parseAssertion() (*AST.Amount, error) {
 	parser.nextToken()
 
-	if parser.current.Type != AST.TOKEN_NEWLINE {
-		return AST.Posting{}, fmt.Errorf("Expected newline after posting at line %d", parser.current.Line)
+	if parser.current.Type != AST.TOKEN_AMOUNT {
+		return nil, parser.errorAt(parser.current, "Expected an amount after =, got %s", describe(parser.current))
+	}
+
+	assertion, err := utils.ParseAmount(parser.current.Value)
+	if err != nil {
+		return nil, parser.errorAt(parser.current, "Invalid balance assertion: %v", err)
 	}
 	parser.nextToken()
 
-	return AST.Posting{Account: account, Amount: amount}, nil
+	return &assertion, nil
+}
+
+// Optional * or ! marker
+func (parser *Parser) parseStatus() (AST.Status, error) {
+	if parser.current.Type != AST.TOKEN_STATUS {
+		return AST.STATUS_UNCLEARED, nil
+	}
+
+	status, err := AST.ParseStatus(parser.current.Value)
+	if err != nil {
+		return status, parser.errorAt(parser.current, "%v", err)
+	}
+	parser.nextToken()
+
+	return status, nil
+}
+
+func (parser *Parser) parsePostingEnd(posting *AST.Posting) error {
+	comment, err := parser.parseEndOfLine()
+	if comment != "" {
+		posting.Comments = append(posting.Comments, comment)
+	}
+	return err
 }
 
 // parseTransactions takes raw ledger text and returns parsed transactions.
 // This is the testable core logic, separated from main().
-func ParseTransactions(input string) ([]*AST.Transaction, error) {
-	parser := runParser(input)
+func ParseTransactions(input string, options Options) ([]*AST.Transaction, error) {
+	journal, err := ParseJournal(input, options)
+	if err != nil {
+		return nil, err
+	}
+	return journal.Transactions(), nil
+}
+
+// ParseJournal keeps everything in the input, not only the transactions
+func ParseJournal(input string, options Options) (*AST.Journal, error) {
+	parser := runParser(input, options)
 	return parser.Parse()
 }
@@ -0,0 +1,134 @@
+package Parser
+
+import (
+	"bufio"
+	AST "gledger/ast"
+	"io"
+)
+
+// ParseReader parses pieces of about this size, cut between items
+const pieceSize = 64 * 1024
+
+/**
+ * ParseReader reads a journal from reader without holding all of it in
+ * memory. The input is cut in pieces of about 64 KiB before a line starting
+ * at the left margin, so each piece holds whole items, and handle gets every
+ * item as soon as its piece is parsed. The text of the items points into
+ * the piece, one lexer and one buffer go through all of them. Like Parse it
+ * goes on after a broken item and returns all of them as Diagnostics at the
+ * end. An error from handle stops the reading.
+ */
+func ParseReader(reader io.Reader, options Options, handle func(*AST.Item) error) error {
+	parser := runParser("", options)
+	buffered := bufio.NewReaderSize(reader, pieceSize)
+
+	var (
+		chunk       []byte
+		chunkLine   = max(options.Line, 1)
+		line        = chunkLine
+		lineStart   = true
+		diagnostics Diagnostics
+		handleErr   error
+	)
+
+	flush := func() {
+		if len(chunk) == 0 {
+			return
+		}
+		parser.reset(string(chunk), chunkLine)
+		diagnostics = append(diagnostics, parser.parseItems(func(item *AST.Item) {
+			if handleErr == nil {
+				handleErr = handle(item)
+			}
+		})...)
+		chunk = chunk[:0]
+	}
+
+	for {
+		text, err := buffered.ReadSlice('\n')
+
+		// Postings and comments indented below an item stay with it
+		if lineStart && len(chunk) >= pieceSize && len(text) > 0 && !continuesItem(text) {
+			flush()
+			chunkLine = line
+		}
+		chunk = append(chunk, text...)
+
+		if handleErr != nil {
+			return handleErr
+		}
+
+		// The line is longer than the buffer, the rest comes with the next read
+		if err == bufio.ErrBufferFull {
+			lineStart = false
+			continue
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		line++
+		lineStart = true
+	}
+
+	flush()
+	if handleErr != nil {
+		return handleErr
+	}
+	if len(diagnostics) > 0 {
+		return diagnostics
+	}
+	return nil
+}
+
+// Indented lines with something on them belong to the item above
+func continuesItem(line []byte) bool {
+	if line[0] != ' ' && line[0] != '\t' {
+		return false
+	}
+	for _, character := range line {
+		if character != ' ' && character != '\t' && character != '\r' && character != '\n' {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * ApplyDirectives does to options what the directives of items parsed
+ * before did to the parser: declare accounts and set the year of dates
+ * written without one. Reading can then go on after items that are not
+ * parsed again.
+ */
+func ApplyDirectives(items []*AST.Item, options *Options) error {
+	if options.Accounts == nil {
+		options.Accounts = map[string]AST.AccountType{}
+	}
+
+	parser := runParser("", *options)
+	for _, item := range items {
+		if item.Kind != AST.ITEM_DIRECTIVE {
+			continue
+		}
+		if err := parser.applyDirective(item.Directive); err != nil {
+			return err
+		}
+	}
+
+	options.Year = parser.year
+	return nil
+}
+
+/**
+ * CheckAccounts does the strict check of transaction, which is in item,
+ * against options.Accounts. Loading parses without it and checks once it
+ * follows the includes, the accounts an include declares then count from
+ * where it is included.
+ */
+func CheckAccounts(item *AST.Item, transaction *AST.Transaction, options Options) error {
+	options.Strict = true
+	options.Line = item.Line
+	return runParser(item.Text, options).checkAccounts(transaction.Postings)
+}
@@ -0,0 +1,232 @@
+package Parser
+
+import (
+	"errors"
+	"fmt"
+	AST "gledger/ast"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseAll(t *testing.T, input string, options Options) ([]*AST.Item, error) {
+	t.Helper()
+	var items []*AST.Item
+	err := ParseReader(strings.NewReader(input), options, func(item *AST.Item) error {
+		items = append(items, item)
+		return nil
+	})
+	return items, err
+}
+
+// Cut into pieces or not, the journal gives the same items with the same text and lines
+func TestParseReaderChunks(t *testing.T) {
+	input := "; opening comment\n" +
+		"account assets:checking\n" +
+		"\n" +
+		"2025-01-02 * Groceries  ; weekly\n" +
+		"    ; :food:\n" +
+		"    expenses:food  $42.50\n" +
+		"    assets:checking\n" +
+		"   \n" +
+		"Y 2024\n" +
+		"03/04 Coffee\n" +
+		"\t\texpenses:food  $3.00\n" +
+		"\t\tassets:checking\n" +
+		"~ monthly from 2025-01  Rent\n" +
+		"    expenses:rent  $1,500.00\n" +
+		"    assets:checking"
+
+	want, err := ParseJournal(input, Options{})
+	if err != nil {
+		t.Fatalf("ParseJournal failed: %v", err)
+	}
+	got, err := parseAll(t, input, Options{})
+	if err != nil {
+		t.Fatalf("ParseReader failed: %v", err)
+	}
+
+	if len(got) != len(want.Items) {
+		t.Fatalf("got %d items, want %d", len(got), len(want.Items))
+	}
+	var text strings.Builder
+	for i, item := range got {
+		expected := want.Items[i]
+		if item.Kind != expected.Kind || item.Line != expected.Line || item.Text != expected.Text {
+			t.Errorf("item %d: got kind %v line %d %q, want kind %v line %d %q", i, item.Kind, item.Line, item.Text, expected.Kind, expected.Line, expected.Text)
+		}
+		text.WriteString(item.Text)
+	}
+	if text.String() != input {
+		t.Errorf("items do not add up to the input:\n%q", text.String())
+	}
+
+	// The yearless date is in the year of the Y directive of an earlier piece
+	for _, item := range got {
+		if item.Kind == AST.ITEM_TRANSACTION && item.Transaction.Description == "Coffee" {
+			if date := item.Transaction.Date; !date.Equal(time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("Coffee is on %s, want 2024-03-04", date.Format("2006-01-02"))
+			}
+		}
+	}
+}
+
+// Lines longer than the 64 KiB buffer are read in several goes and stay in one item
+func TestParseReaderLongLines(t *testing.T) {
+	note := strings.Repeat("x", 200*1024)
+	description := strings.Repeat("Payee ", 20*1024)
+	input := "2025-01-02 " + description + "\n" +
+		"    expenses:food  $1.00  ; " + note + "\n" +
+		"    assets:checking\n" +
+		"\n" +
+		"2025-01-03 Next\n" +
+		"    expenses:food  $2.00\n" +
+		"    assets:checking\n"
+
+	items, err := parseAll(t, input, Options{})
+	if err != nil {
+		t.Fatalf("ParseReader failed: %v", err)
+	}
+
+	var transactions []*AST.Item
+	for _, item := range items {
+		if item.Kind == AST.ITEM_TRANSACTION {
+			transactions = append(transactions, item)
+		}
+	}
+	if len(transactions) != 2 {
+		t.Fatalf("got %d transactions, want 2", len(transactions))
+	}
+
+	first := transactions[0].Transaction
+	if first.Description != strings.TrimSpace(description) {
+		t.Errorf("description is %d characters long, want %d", len(first.Description), len(strings.TrimSpace(description)))
+	}
+	if comments := first.Postings[0].Comments; len(comments) != 1 || comments[0] != note {
+		t.Errorf("the comment of the first posting was not read whole")
+	}
+	if line := transactions[1].Line; line != 5 {
+		t.Errorf("second transaction is on line %d, want 5", line)
+	}
+}
+
+// Diagnostics count lines from options.Line, and reading goes on after a broken item
+func TestParseReaderDiagnostics(t *testing.T) {
+	input := "2025-01-02 Fine\n" +
+		"    expenses:food  $1.00\n" +
+		"    assets:checking\n" +
+		"\n" +
+		"2025-01-03 Broken\n" +
+		"    expenses:food  $1,50\n" +
+		"    assets:checking\n" +
+		"\n" +
+		"2025-13-01 Bad date\n" +
+		"    expenses:food  $1.00\n" +
+		"    assets:checking\n" +
+		"\n" +
+		"2025-01-04 Also fine\n" +
+		"    expenses:food  $1.00\n" +
+		"    assets:checking\n"
+
+	tests := []struct {
+		start int
+		lines []int
+	}{
+		{0, []int{6, 9}},
+		{1, []int{6, 9}},
+		{101, []int{106, 109}},
+	}
+
+	for _, test := range tests {
+		items, err := parseAll(t, input, Options{Line: test.start})
+
+		var diagnostics Diagnostics
+		if !errors.As(err, &diagnostics) {
+			t.Fatalf("starting at line %d: got %v, want Diagnostics", test.start, err)
+		}
+		if len(diagnostics) != len(test.lines) {
+			t.Fatalf("starting at line %d: got %d diagnostics, want %d:\n%v", test.start, len(diagnostics), len(test.lines), err)
+		}
+		for i, diagnostic := range diagnostics {
+			if diagnostic.Line != test.lines[i] {
+				t.Errorf("starting at line %d: diagnostic %d is on line %d, want %d", test.start, i, diagnostic.Line, test.lines[i])
+			}
+		}
+
+		last := items[len(items)-1]
+		if last.Kind != AST.ITEM_TRANSACTION || last.Transaction.Description != "Also fine" {
+			t.Errorf("starting at line %d: the items after the broken ones were not handled", test.start)
+		}
+	}
+}
+
+func TestParseReaderHandleError(t *testing.T) {
+	stop := errors.New("stop")
+	calls := 0
+	err := ParseReader(strings.NewReader(generateJournal(10)), Options{}, func(item *AST.Item) error {
+		calls++
+		return stop
+	})
+	if err != stop {
+		t.Errorf("got %v, want the error of handle", err)
+	}
+	if calls != 1 {
+		t.Errorf("handle was called %d times after it failed", calls)
+	}
+}
+
+/**
+ * The time and the allocations per transaction should stay about the same
+ * however big the journal gets: go test -bench ParseReader -benchmem ./parser
+ */
+func BenchmarkParseReader(b *testing.B) {
+	for _, size := range []int{1000, 10000, 100000} {
+		journal := generateJournal(size)
+
+		b.Run(fmt.Sprintf("transactions=%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(journal)))
+			for i := 0; i < b.N; i++ {
+				count := 0
+				err := ParseReader(strings.NewReader(journal), Options{}, func(item *AST.Item) error {
+					if item.Kind == AST.ITEM_TRANSACTION {
+						count++
+					}
+					return nil
+				})
+				if err != nil {
+					b.Fatalf("generated journal did not parse: %v", err)
+				}
+				if count != size {
+					b.Fatalf("parsed %d transactions instead of %d", count, size)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*size), "ns/txn")
+		})
+	}
+}
+
+// A journal of count transactions, a few a day, with the usual things in them
+func generateJournal(count int) string {
+	accounts := []string{"expenses:food:groceries", "expenses:food:dining", "expenses:rent", "expenses:transport", "expenses:utilities"}
+	start := time.Date(2010, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	var journal strings.Builder
+	for i := 0; i < count; i++ {
+		date := start.AddDate(0, 0, i/4).Format("2006-01-02")
+		account := accounts[i%len(accounts)]
+		amount := fmt.Sprintf("$%d.%02d", 1+i%250, i%100)
+
+		switch i % 4 {
+		case 0:
+			fmt.Fprintf(&journal, "%s * Payee %d\n    ; :import:\n    %s  %s\n    assets:checking\n\n", date, i%97, account, amount)
+		case 1:
+			fmt.Fprintf(&journal, "%s Payee %d  ; note\n    %s  %s  ; receipt:%d\n    liabilities:credit card  -%s\n\n", date, i%97, account, amount, i, amount)
+		case 2:
+			fmt.Fprintf(&journal, "%s ! Broker\n    assets:brokerage  2 AAPL @ %s\n    assets:checking\n\n", date, amount)
+		default:
+			fmt.Fprintf(&journal, "; %s\n%s Split\n    %s  %s\n    expenses:misc  $1.00\n    assets:checking\n\n", date, date, account, amount)
+		}
+	}
+	return journal.String()
+}
@@ -21,6 +21,7 @@ func (p *TemplatePlugin) OnParse(transactions *AST.Transaction) error {
 	return nil
 }
 
+// Reports go through here, transaction.Tags and posting.Tags can be used to narrow them down
 func (p *TemplatePlugin) OnFilter(transactions []*AST.Transaction) []*AST.Transaction {
 	return transactions
 }
@@ -22,6 +22,7 @@ const (
 	VIEW_LIST ViewMode = iota
 	VIEW_ADD
 	VIEW_REPORT
+	VIEW_BUDGET
 	VIEW_HELP
 )
 
@@ -34,6 +35,17 @@ type Model struct {
 	formFocus   int
 	message     string
 	err         error
+	loadErr     error                     // the journal could not be read, saving would overwrite it
+	filter      Interpreter.ReportOptions // applied to the table, the balances and the reports
+	statusIndex int                       // position in statusFilters
+}
+
+// Cycle of status filters for the "s" key, nil shows everything
+var statusFilters = [][]AST.Status{
+	nil,
+	{AST.STATUS_CLEARED},
+	{AST.STATUS_PENDING},
+	{AST.STATUS_UNCLEARED},
 }
 
 func InitialModel() (Model, error) {
@@ -44,15 +56,17 @@ func InitialModel() (Model, error) {
 
 	interpreter := Interpreter.NewInterpreter(config)
 
-	if err := interpreter.LoadFromFile(config.DataFile); err != nil {
-		fmt.Printf("Error loading transactions: %v\n", err)
+	loadErr := interpreter.LoadFromFile(config.DataFile)
+	if loadErr != nil {
+		fmt.Printf("Error loading transactions: %v\n", loadErr)
 	}
 
 	columns := []table.Column{
 		{Title: "Date", Width: 12},
+		{Title: "St", Width: 2},
 		{Title: "Description", Width: 30},
-		{Title: "Amount", Width: 10},
-		{Title: "Account", Width: 20},
+		{Title: "Account", Width: 30},
+		{Title: "Amount", Width: 14},
 	}
 
 	t := table.New(table.WithColumns(columns), table.WithFocused(true), table.WithHeight(15))
@@ -74,9 +88,9 @@ func InitialModel() (Model, error) {
 	inputs := make([]textinput.Model, 5)
 
 	inputs[0] = textinput.New()
-	inputs[0].Placeholder = "Date (YYYY-MM-DD)"
+	inputs[0].Placeholder = "Date (" + utils.DatePattern(config.DateFormat) + ")"
 	inputs[0].Prompt = "Date: "
-	inputs[0].CharLimit = 10
+	inputs[0].CharLimit = 20
 	inputs[0].Width = 30
 	inputs[0].Focus()
 
@@ -111,6 +125,7 @@ func InitialModel() (Model, error) {
 		table:       t,
 		formInputs:  inputs,
 		formFocus:   0,
+		loadErr:     loadErr,
 	}
 
 	m.updateTableRows()
@@ -133,6 +148,9 @@ func (model Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			/**
 			* Save before you go go go
 			 */
+			if model.loadErr != nil {
+				return model, tea.Quit
+			}
 			if err := model.interpreter.SaveToFile(model.config.DataFile); err != nil {
 				fmt.Printf("Error saving transactions: %v\n", err)
 				model.err = err
@@ -156,6 +174,8 @@ func (model Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return model.updateAdd(msg)
 		case VIEW_REPORT:
 			return model.updateReport(msg)
+		case VIEW_BUDGET:
+			return model.updateBudget(msg)
 		}
 
 	case tea.WindowSizeMsg:
@@ -175,11 +195,22 @@ func (model Model) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		model.formFocus = 0
 		model.formInputs[0].Focus()
 
-		model.formInputs[0].SetValue(time.Now().Format("2006-01-02"))
+		model.formInputs[0].SetValue(time.Now().Format(model.config.DateLayout()))
 		return model, textinput.Blink
 
 	case "r":
 		model.currentView = VIEW_REPORT
+	case "b":
+		model.currentView = VIEW_BUDGET
+		return model, nil
+	case "s":
+		model.statusIndex = (model.statusIndex + 1) % len(statusFilters)
+		model.filter.Statuses = statusFilters[model.statusIndex]
+		model.updateTableRows()
+		return model, nil
+	case "v":
+		model.filter.Market = !model.filter.Market
+		return model, nil
 	case "enter":
 		return model, nil
 	}
@@ -224,7 +255,7 @@ func (model Model) updateAdd(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 			for i := range model.formInputs {
 				if i == 0 {
-					model.formInputs[i].SetValue(time.Now().Format("2006-01-02"))
+					model.formInputs[i].SetValue(time.Now().Format(model.config.DateLayout()))
 				} else {
 					model.formInputs[i].SetValue("")
 				}
@@ -243,11 +274,18 @@ func (model Model) updateReport(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return model, nil
 }
 
+func (model Model) updateBudget(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if msg.String() == "esc" {
+		model.currentView = VIEW_LIST
+	}
+	return model, nil
+}
+
 func (m *Model) submitTransaction() error {
 	// Parse date
-	date, err := time.Parse("2006-01-02", m.formInputs[0].Value())
+	date, err := utils.ParseDate(m.formInputs[0].Value(), m.config.DateFormat, time.Now().Year())
 	if err != nil {
-		return fmt.Errorf("invalid date format")
+		return err
 	}
 
 	description := m.formInputs[1].Value()
@@ -259,17 +297,27 @@ func (m *Model) submitTransaction() error {
 	if account1 == "" {
 		return fmt.Errorf("account 1 is required")
 	}
+	if err := m.interpreter.CheckAccount(account1); err != nil {
+		return err
+	}
 
 	amount1Str := m.formInputs[3].Value()
 	amount1, err := utils.ParseAmount(amount1Str)
 	if err != nil {
 		return fmt.Errorf("invalid amount 1")
 	}
+	amount1 = utils.WithDefaultCommodity(amount1, m.config.Currency)
+
+	amount2 := amount1
+	amount2.Value = amount1.Value.Neg()
 
 	account2 := m.formInputs[4].Value()
 	if account2 == "" {
 		return fmt.Errorf("account 2 is required")
 	}
+	if err := m.interpreter.CheckAccount(account2); err != nil {
+		return err
+	}
 
 	// Create transaction
 	txn := &AST.Transaction{
@@ -277,10 +325,14 @@ func (m *Model) submitTransaction() error {
 		Description: description,
 		Postings: []AST.Posting{
 			{Account: account1, Amount: amount1},
-			{Account: account2, Amount: AST.Amount{Value: -amount1.Value, Currency: amount1.Currency}},
+			{Account: account2, Amount: amount2},
 		},
 	}
 
+	if m.loadErr != nil {
+		return fmt.Errorf("%s could not be loaded, fix it before adding transactions", m.config.DataFile)
+	}
+
 	// Add to engine
 	if err := m.interpreter.AddTransaction(txn); err != nil {
 		return err
@@ -294,13 +346,17 @@ func (m *Model) submitTransaction() error {
 }
 
 func (m *Model) updateTableRows() {
-	txns := m.interpreter.GetTransactions()
+	txns := m.interpreter.FilterTransactions(m.filter)
 
 	var rows []table.Row
 	for _, txn := range txns {
 		for _, posting := range txn.Postings {
+			if !m.filter.MatchesPosting(txn, &posting) {
+				continue
+			}
 			rows = append(rows, table.Row{
-				txn.Date.Format("2006-01-02"),
+				txn.Date.Format(m.config.DateLayout()),
+				txn.PostingStatus(&posting).Marker(),
 				txn.Description,
 				posting.Account,
 				posting.Amount.String(),
@@ -311,6 +367,17 @@ func (m *Model) updateTableRows() {
 	m.table.SetRows(rows)
 }
 
+func statusFilterName(statuses []AST.Status) string {
+	if len(statuses) == 0 {
+		return "all"
+	}
+	var names []string
+	for _, status := range statuses {
+		names = append(names, status.String())
+	}
+	return strings.Join(names, ", ")
+}
+
 func (m Model) View() string {
 	var s strings.Builder
 
@@ -341,6 +408,8 @@ func (m Model) View() string {
 		s.WriteString(m.viewAdd())
 	case VIEW_REPORT:
 		s.WriteString(m.viewReport())
+	case VIEW_BUDGET:
+		s.WriteString(m.viewBudget())
 	case VIEW_HELP:
 		s.WriteString(m.viewHelp())
 	}
@@ -351,20 +420,24 @@ func (m Model) View() string {
 func (m Model) viewList() string {
 	var s strings.Builder
 
-	s.WriteString("Transactions\n")
+	s.WriteString(fmt.Sprintf("Transactions (%s)\n", statusFilterName(m.filter.Statuses)))
 	s.WriteString("────────────────────────────────────────────────────────────────────────────\n\n")
 	s.WriteString(m.table.View())
 	s.WriteString("\n\n")
 
 	// Show summary
-	balances := m.interpreter.CalculateBalances()
-	s.WriteString("Account Balances:\n")
+	balances := m.interpreter.CalculateBalances(m.filter)
+	if m.filter.Market {
+		s.WriteString(fmt.Sprintf("Account Balances (market value in %s):\n", m.config.Currency))
+	} else {
+		s.WriteString("Account Balances:\n")
+	}
 	for account, balance := range balances {
-		s.WriteString(fmt.Sprintf("  %-40s %10.2f\n", account, balance))
+		s.WriteString(fmt.Sprintf("  %-40s %14s\n", account, balance.String()))
 	}
 
 	s.WriteString("\n")
-	s.WriteString("Commands: [a]dd  [r]eport  [?]help  [q]uit\n")
+	s.WriteString("Commands: [a]dd  [r]eport  [b]udget  [s]tatus filter  [v]alue  [?]help  [q]uit\n")
 
 	return s.String()
 }
@@ -394,9 +467,13 @@ func (m Model) viewReport() string {
 	s.WriteString("Financial Reports\n")
 	s.WriteString("────────────────────────────────────────────────────────────────────────────\n\n")
 
-	report := m.interpreter.GenerateBalanceReport()
+	report := m.interpreter.GenerateBalanceReport(m.filter)
 	s.WriteString(report)
 
+	if holdings := m.interpreter.GetHoldings(); len(holdings.Lots) > 0 || len(holdings.Gains) > 0 {
+		s.WriteString(m.interpreter.GenerateGainsReport(m.filter))
+	}
+
 	// Plugin reportss
 	pluginReports := m.interpreter.GetPluginReports()
 	for _, report := range pluginReports {
@@ -409,6 +486,19 @@ func (m Model) viewReport() string {
 	return s.String()
 }
 
+func (m Model) viewBudget() string {
+	var s strings.Builder
+
+	s.WriteString("Budget\n")
+	s.WriteString("────────────────────────────────────────────────────────────────────────────\n\n")
+
+	s.WriteString(m.interpreter.GenerateBudgetReport(Interpreter.BudgetOptions{ReportOptions: m.filter}))
+
+	s.WriteString("\nCommands: [esc]back\n")
+
+	return s.String()
+}
+
 func (m Model) viewHelp() string {
 	var s strings.Builder
 
@@ -425,13 +515,16 @@ func (m Model) viewHelp() string {
 	s.WriteString("Keyboard Shortcuts:\n")
 	s.WriteString("  a       - Add new transaction\n")
 	s.WriteString("  r       - View reports\n")
+	s.WriteString("  b       - Budget vs actual, month by month\n")
+	s.WriteString("  s       - Cycle status filter (all, cleared, pending, uncleared)\n")
+	s.WriteString("  v       - Toggle market value of balances and reports\n")
 	s.WriteString("  ?       - Show this help\n")
 	s.WriteString("  q       - Quit (and save)\n")
 	s.WriteString("  esc     - Go back\n")
 	s.WriteString("  tab     - Navigate form fields\n\n")
 
 	s.WriteString("File Format:\n")
-	s.WriteString("  2024-01-15 Grocery Store\n")
+	s.WriteString("  2024-01-15 * Grocery Store\n")
 	s.WriteString("      expenses:groceries        $45.32\n")
 	s.WriteString("      assets:checking          -$45.32\n\n")
 
@@ -1,29 +1,159 @@
 package utils
 
 import (
+	"fmt"
 	AST "gledger/ast"
+	"gledger/decimal"
 	"os"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
+// Currency symbols we know the ISO code for, $100 and 100 USD are the same commodity
+var currencySymbols = map[string]string{
+	"$": "USD",
+	"€": "EUR",
+	"£": "GBP",
+	"¥": "JPY",
+	"₹": "INR",
+}
+
+/**
+ * ParseAmount reads amounts like $45.32, -$1,204.18, 100.00 EUR, €100, 10 AAPL
+ * or -5.5 "VANGUARD 500". Amounts without a commodity are allowed and keep
+ * an empty commodity.
+ */
 func ParseAmount(s string) (AST.Amount, error) {
 	s = strings.TrimSpace(s)
+	amount := AST.Amount{}
 
-	// Remove currency symbol
-	s = strings.Replace(s, "$", "", -1)
+	negative := false
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
 
-	// Parse the numeric value
-	value, err := strconv.ParseFloat(s, 64)
+	// Commodity before the number
+	prefix, rest, err := readCommodity(s)
 	if err != nil {
 		return AST.Amount{}, err
 	}
+	if prefix != "" {
+		amount.Style.Prefix = true
+		amount.Style.Spaced = strings.HasPrefix(rest, " ") || strings.HasPrefix(rest, "\t")
+		rest = strings.TrimLeft(rest, " \t")
+
+		// $-45.32 is also a thing
+		if strings.HasPrefix(rest, "-") || strings.HasPrefix(rest, "+") {
+			negative = negative != (rest[0] == '-')
+			rest = rest[1:]
+		}
+	}
 
-	return AST.Amount{
-		Value:    value,
-		Currency: "USD",
-	}, nil
+	// The number itself
+	end := 0
+	for end < len(rest) && (isDigit(rest[end]) || rest[end] == '.' || rest[end] == ',') {
+		end++
+	}
+	if end == 0 {
+		return AST.Amount{}, fmt.Errorf("missing number in amount %q", s)
+	}
+
+	value, err := decimal.Parse(rest[:end])
+	if err != nil {
+		return AST.Amount{}, err
+	}
+	amount.Style.Grouped = strings.Contains(rest[:end], ",")
+	if negative {
+		value = value.Neg()
+	}
+	amount.Value = value
+	rest = rest[end:]
+
+	// Commodity after the number
+	if trimmed := strings.TrimLeft(rest, " \t"); trimmed != "" {
+		if prefix != "" {
+			return AST.Amount{}, fmt.Errorf("unexpected %q after amount", trimmed)
+		}
+
+		suffix, remaining, err := readCommodity(trimmed)
+		if err != nil {
+			return AST.Amount{}, err
+		}
+		if suffix == "" || strings.TrimSpace(remaining) != "" {
+			return AST.Amount{}, fmt.Errorf("unexpected %q after amount", trimmed)
+		}
+
+		prefix = suffix
+		amount.Style.Spaced = len(trimmed) != len(rest)
+	}
+
+	if prefix != "" {
+		amount.Commodity = prefix
+		if code, isSymbol := currencySymbols[prefix]; isSymbol {
+			amount.Commodity = code
+			amount.Style.Symbol = prefix
+		}
+	}
+
+	return amount, nil
+}
+
+// Amounts typed without a commodity get the configured default one
+func WithDefaultCommodity(amount AST.Amount, currency string) AST.Amount {
+	if amount.Commodity != "" || currency == "" {
+		return amount
+	}
+
+	amount.Commodity = currency
+	for symbol, code := range currencySymbols {
+		if code == currency {
+			amount.Style = AST.AmountStyle{Symbol: symbol, Prefix: true}
+			return amount
+		}
+	}
+	amount.Style = AST.AmountStyle{Spaced: true}
+	return amount
+}
+
+/**
+ * Read a commodity from the start of s, either quoted ("VANGUARD 500")
+ * or a run of letters and symbols (USD, $, €). Returns the rest of s.
+ */
+func readCommodity(s string) (string, string, error) {
+	if strings.HasPrefix(s, `"`) {
+		end := strings.Index(s[1:], `"`)
+		if end < 0 {
+			return "", s, fmt.Errorf("unterminated commodity in %q", s)
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+
+	end := 0
+	for end < len(s) {
+		character, size := utf8.DecodeRuneInString(s[end:])
+		if !IsCommodityRune(character) {
+			break
+		}
+		end += size
+	}
+	return s[:end], s[end:], nil
+}
+
+// Anything that is not a digit, whitespace or part of the journal syntax
+func IsCommodityRune(character rune) bool {
+	if unicode.IsSpace(character) || unicode.IsDigit(character) {
+		return false
+	}
+	return !strings.ContainsRune("-+.,;:@=*!{}[]()\"", character)
+}
+
+func isDigit(character byte) bool {
+	return character >= '0' && character <= '9'
 }
 
 func ExpandHome(path string) string {
@@ -36,3 +166,124 @@ func ExpandHome(path string) string {
 	}
 	return path
 }
+
+/**
+ * Candidates closest to target by edit distance, best first. Used to
+ * suggest the account someone meant when they made a typo.
+ */
+func ClosestMatches(target string, candidates []string, limit int) []string {
+	type match struct {
+		candidate string
+		distance  int
+	}
+
+	// Allow roughly one typo every four characters
+	threshold := len([]rune(target))/4 + 1
+
+	var matches []match
+	for _, candidate := range candidates {
+		if distance := editDistance(target, candidate); distance <= threshold {
+			matches = append(matches, match{candidate, distance})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].candidate < matches[j].candidate
+	})
+
+	var result []string
+	for i := 0; i < len(matches) && i < limit; i++ {
+		result = append(result, matches[i].candidate)
+	}
+	return result
+}
+
+// Levenshtein distance between two strings, counted in characters
+func editDistance(a, b string) int {
+	first, second := []rune(a), []rune(b)
+	previous := make([]int, len(second)+1)
+	current := make([]int, len(second)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(first); i++ {
+		current[0] = i
+		for j := 1; j <= len(second); j++ {
+			cost := 1
+			if first[i-1] == second[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(second)]
+}
+
+// The error for a posting to an account nobody declared, with suggestions
+func UnknownAccountError(account string, declared map[string]AST.AccountType) error {
+	names := make([]string, 0, len(declared))
+	for name := range declared {
+		names = append(names, name)
+	}
+
+	message := fmt.Sprintf("Unknown account %q, declare it with \"account %s\" or fix the name", account, account)
+	if matches := ClosestMatches(account, names, 3); len(matches) > 0 {
+		message += fmt.Sprintf(" (did you mean %s?)", strings.Join(matches, ", "))
+	}
+	return fmt.Errorf("%s", message)
+}
+
+// Dates are written like this when the config does not say otherwise
+const DefaultDateFormat = "2006-01-02"
+
+// Formats always understood, next to the configured one. 1 and 2 also read 01 and 02
+var dateLayouts = []string{"2006-1-2", "2006/1/2", "2006.1.2", "2.1.2006"}
+
+/**
+ * ParseDate reads a date in the configured layout (a Go layout, empty for
+ * the default) or one of 2025-01-15, 2025/01/15, 2025.01.15 and 15.01.2025.
+ * A date without a year, 01/15, is in the given year.
+ */
+func ParseDate(value, layout string, year int) (time.Time, error) {
+	// Dates are read for every transaction, the layouts are put together on the stack
+	var candidates [8]string
+	layouts := candidates[:0]
+	if layout != "" {
+		layouts = append(layouts, layout)
+	}
+	layouts = append(layouts, dateLayouts...)
+	layouts = append(layouts, "1/2")
+
+	for _, candidate := range layouts {
+		date, err := time.Parse(candidate, value)
+		if err != nil {
+			continue
+		}
+		if date.Year() == 0 {
+			withYear := time.Date(year, date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+			// February 29th only exists in leap years
+			if withYear.Day() != date.Day() {
+				break
+			}
+			date = withYear
+		}
+		return date, nil
+	}
+
+	return time.Time{}, fmt.Errorf("Invalid date %q, expected %s", value, DatePattern(layout))
+}
+
+// The layout the way people write it: 2006-01-02 is YYYY-MM-DD
+func DatePattern(layout string) string {
+	if layout == "" {
+		layout = DefaultDateFormat
+	}
+	return strings.NewReplacer("2006", "YYYY", "01", "MM", "02", "DD", "06", "YY").Replace(layout)
+}